@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// BaselineComparison compares a run against the JSON report of a previous run
+type BaselineComparison struct {
+	File        string           `json:"file"`
+	StartedAt   time.Time        `json:"started_at"`
+	Tolerance   float64          `json:"tolerance_percent"`
+	Tests       []TestComparison `json:"tests"`
+	Regressions int              `json:"regressions"`
+}
+
+// TestComparison holds the change of one test relative to the baseline, in percent.
+// Positive throughput deltas and negative latency deltas are improvements.
+type TestComparison struct {
+	Name          string   `json:"name"`
+	InBaseline    bool     `json:"in_baseline"`
+	ThroughputPct float64  `json:"throughput_delta_pct"`
+	P50Pct        float64  `json:"p50_delta_pct"`
+	P95Pct        float64  `json:"p95_delta_pct"`
+	P99Pct        float64  `json:"p99_delta_pct"`
+	P999Pct       float64  `json:"p999_delta_pct"`
+	Regressions   []string `json:"regressions,omitempty"`
+}
+
+func loadBaseline(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// compareToBaseline matches results to baseline tests by name and flags every
+// metric that got worse by more than tolerance percent
+func compareToBaseline(path string, baseline *Report, results []TestResult, tolerance float64) *BaselineComparison {
+	previous := make(map[string]TestResult, len(baseline.Tests))
+	for _, r := range baseline.Tests {
+		previous[r.Name] = r
+	}
+
+	cmp := &BaselineComparison{
+		File:      path,
+		StartedAt: baseline.StartedAt,
+		Tolerance: tolerance,
+	}
+
+	for _, r := range results {
+		tc := TestComparison{Name: r.Name}
+		base, ok := previous[r.Name]
+		if !ok {
+			cmp.Tests = append(cmp.Tests, tc)
+			continue
+		}
+		tc.InBaseline = true
+
+		tc.ThroughputPct = percentChange(base.OpsPerSecond, r.OpsPerSecond)
+		tc.P50Pct = percentChange(float64(base.P50Latency), float64(r.P50Latency))
+		tc.P95Pct = percentChange(float64(base.P95Latency), float64(r.P95Latency))
+		tc.P99Pct = percentChange(float64(base.P99Latency), float64(r.P99Latency))
+		tc.P999Pct = percentChange(float64(base.P999Latency), float64(r.P999Latency))
+
+		if tc.ThroughputPct < -tolerance {
+			tc.Regressions = append(tc.Regressions, fmt.Sprintf("throughput %+.1f%%", tc.ThroughputPct))
+		}
+		for _, l := range []struct {
+			name string
+			pct  float64
+		}{{"P50", tc.P50Pct}, {"P95", tc.P95Pct}, {"P99", tc.P99Pct}, {"P99.9", tc.P999Pct}} {
+			if l.pct > tolerance {
+				tc.Regressions = append(tc.Regressions, fmt.Sprintf("%s %+.1f%%", l.name, l.pct))
+			}
+		}
+		if len(tc.Regressions) > 0 {
+			cmp.Regressions++
+		}
+
+		cmp.Tests = append(cmp.Tests, tc)
+	}
+
+	return cmp
+}
+
+func percentChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before * 100
+}
+
+func printBaselineReport(cmp *BaselineComparison) {
+	printSection("Baseline Comparison")
+	fmt.Println()
+	logInfo("Baseline", fmt.Sprintf("%s (run started %s)", cmp.File, cmp.StartedAt.Format(time.RFC3339)))
+	logInfo("Tolerance", fmt.Sprintf("%.1f%%", cmp.Tolerance))
+	fmt.Println()
+
+	fmt.Println("   ┌──────────────────────────────────────────┬──────────┬──────────┬──────────┬──────────┬──────────┐")
+	fmt.Printf("   │ %-40s │ %-8s │ %-8s │ %-8s │ %-8s │ %-8s │\n", "Test Name", "Ops/Sec", "P50", "P95", "P99", "P99.9")
+	fmt.Println("   ├──────────────────────────────────────────┼──────────┼──────────┼──────────┼──────────┼──────────┤")
+
+	for _, tc := range cmp.Tests {
+		name := tc.Name
+		if len(name) > 38 {
+			name = name[:35] + "..."
+		}
+		if !tc.InBaseline {
+			fmt.Printf("   │ %-40s │ %-52s │\n", name, "(not in baseline)")
+			continue
+		}
+		fmt.Printf("   │ %-40s │ %+7.1f%% │ %+7.1f%% │ %+7.1f%% │ %+7.1f%% │ %+7.1f%% │\n",
+			name, tc.ThroughputPct, tc.P50Pct, tc.P95Pct, tc.P99Pct, tc.P999Pct)
+	}
+
+	fmt.Println("   └──────────────────────────────────────────┴──────────┴──────────┴──────────┴──────────┴──────────┘")
+	fmt.Println()
+
+	if cmp.Regressions == 0 {
+		fmt.Printf("   %s[OK]%s No regressions beyond %.1f%%\n", Green, Reset, cmp.Tolerance)
+		return
+	}
+	for _, tc := range cmp.Tests {
+		if len(tc.Regressions) > 0 {
+			fmt.Printf("   %s[REGRESSION]%s %s: %v\n", Red, Reset, tc.Name, tc.Regressions)
+		}
+	}
+}
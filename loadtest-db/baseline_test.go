@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		before, after, want float64
+	}{
+		{100, 100, 0},
+		{100, 150, 50},
+		{100, 50, -50},
+		{200, 0, -100},
+		{0, 10, 0}, // no baseline value to compare with
+		{0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := percentChange(tt.before, tt.after); got != tt.want {
+			t.Errorf("percentChange(%g, %g) = %g, want %g", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestCompareToBaseline(t *testing.T) {
+	ms := time.Millisecond
+	result := func(name string, ops float64, p99 time.Duration) TestResult {
+		return TestResult{Name: name, OpsPerSecond: ops, P50Latency: ms, P95Latency: 2 * ms, P99Latency: p99, P999Latency: p99}
+	}
+	baseline := &Report{Tests: []TestResult{
+		result("steady", 1000, 10*ms),
+		result("slower", 1000, 10*ms),
+		result("less throughput", 1000, 10*ms),
+		result("faster", 1000, 10*ms),
+		result("within tolerance", 1000, 10*ms),
+	}}
+
+	tests := []struct {
+		result      TestResult
+		inBaseline  bool
+		regressions []string
+	}{
+		{result("steady", 1000, 10*ms), true, nil},
+		{result("slower", 1000, 15*ms), true, []string{"P99 +50.0%", "P99.9 +50.0%"}},
+		{result("less throughput", 800, 10*ms), true, []string{"throughput -20.0%"}},
+		{result("faster", 2000, 5*ms), true, nil},
+		{result("within tolerance", 950, 10500*time.Microsecond), true, nil},
+		{result("new test", 10, time.Second), false, nil},
+	}
+	var results []TestResult
+	for _, tt := range tests {
+		results = append(results, tt.result)
+	}
+
+	cmp := compareToBaseline("baseline.json", baseline, results, 10)
+	if cmp.Regressions != 2 {
+		t.Errorf("%d regressions, want 2", cmp.Regressions)
+	}
+	if len(cmp.Tests) != len(tests) {
+		t.Fatalf("%d comparisons, want %d", len(cmp.Tests), len(tests))
+	}
+	for i, tt := range tests {
+		tc := cmp.Tests[i]
+		if tc.Name != tt.result.Name || tc.InBaseline != tt.inBaseline || !reflect.DeepEqual(tc.Regressions, tt.regressions) {
+			t.Errorf("%s: in baseline %v, regressions %q; want %v, %q", tt.result.Name, tc.InBaseline, tc.Regressions, tt.inBaseline, tt.regressions)
+		}
+	}
+	if got := cmp.Tests[3].ThroughputPct; got != 100 {
+		t.Errorf("faster: throughput delta %g%%, want +100%%", got)
+	}
+}
+
+func TestLoadBaselineErrors(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{bad, filepath.Join(dir, "missing.json")} {
+		if _, err := loadBaseline(path); err == nil {
+			t.Errorf("loadBaseline(%s) succeeded, want an error", path)
+		}
+	}
+}
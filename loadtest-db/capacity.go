@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Capacity search modes
+const (
+	SearchConcurrency = "concurrency"
+	SearchRate        = "rate"
+)
+
+// CapacitySearch steps up the load of a test until P99 latency or the error rate
+// crosses a limit. Each step is a full run of the test at the next load level.
+type CapacitySearch struct {
+	Mode         string   `json:"mode"`
+	Start        float64  `json:"start"`
+	Step         float64  `json:"step"`
+	Max          float64  `json:"max"`
+	StepDuration Duration `json:"step_duration,omitempty"`
+	MaxP99       Duration `json:"max_p99,omitempty"`
+	MaxErrorRate float64  `json:"max_error_rate,omitempty"` // percent
+}
+
+// CapacityResult is the outcome of a capacity search for one test
+type CapacityResult struct {
+	Name       string         `json:"name"`
+	Workload   string         `json:"workload"`
+	Mode       string         `json:"mode"`
+	Steps      []CapacityStep `json:"steps"`
+	KneeLevel  float64        `json:"knee_level"` // highest load level that stayed within the limits, 0 if none did
+	KneeOps    float64        `json:"knee_ops_per_second"`
+	KneeP99    time.Duration  `json:"knee_p99_latency_ns"`
+	StopReason string         `json:"stop_reason"`
+}
+
+// CapacityStep is a single load level of a capacity search
+type CapacityStep struct {
+	Level  float64    `json:"level"`
+	Result TestResult `json:"result"`
+	Passed bool       `json:"passed"`
+}
+
+func (c *CapacitySearch) validate() error {
+	switch c.Mode {
+	case SearchConcurrency, SearchRate:
+	default:
+		return fmt.Errorf("unknown search mode %q (use concurrency or rate)", c.Mode)
+	}
+	if c.Start <= 0 || c.Step <= 0 {
+		return fmt.Errorf("search start and step must be positive")
+	}
+	if c.Max < c.Start {
+		return fmt.Errorf("search max must be at least start")
+	}
+	if c.MaxP99 <= 0 && c.MaxErrorRate <= 0 {
+		return fmt.Errorf("search needs max_p99 and/or max_error_rate")
+	}
+	return nil
+}
+
+// runCapacitySearch runs the test at increasing load levels and stops at the first
+// level that breaks a limit. It returns the search summary and every step's result.
+func runCapacitySearch(db *sql.DB, test ScenarioTest, workload Workload, env testEnv) CapacityResult {
+	search := test.Search
+	result := CapacityResult{
+		Name:     test.Name,
+		Workload: test.Workload,
+		Mode:     search.Mode,
+	}
+
+	for level := search.Start; level <= search.Max; level += search.Step {
+		step := test
+		if search.StepDuration > 0 {
+			step.Duration = search.StepDuration
+		}
+		if search.Mode == SearchRate {
+			step.Rate = level
+			step.Name = fmt.Sprintf("%s @ %.0f ops/s", test.Name, level)
+		} else {
+			step.Concurrency = int(level)
+			step.Name = fmt.Sprintf("%s @ %d workers", test.Name, step.Concurrency)
+		}
+
+		r := runTest(db, step, workload, env)
+		reason := search.check(r)
+		result.Steps = append(result.Steps, CapacityStep{Level: level, Result: r, Passed: reason == ""})
+
+		if reason != "" {
+			result.StopReason = reason
+			fmt.Printf("   [KNEE] Stopping search at %s: %s\n", formatSearchLevel(search.Mode, level), reason)
+			break
+		}
+		result.KneeLevel = level
+		result.KneeOps = r.OpsPerSecond
+		result.KneeP99 = r.P99Latency
+	}
+
+	if result.StopReason == "" {
+		result.StopReason = fmt.Sprintf("reached search max %s without crossing a limit", formatSearchLevel(search.Mode, search.Max))
+	}
+	return result
+}
+
+// check returns why a step broke the search limits, or "" if it stayed within them
+func (c *CapacitySearch) check(r TestResult) string {
+	if r.TotalOps == 0 {
+		return "no operations completed"
+	}
+	if c.MaxP99 > 0 && r.P99Latency > time.Duration(c.MaxP99) {
+		return fmt.Sprintf("P99 %v > %v", r.P99Latency.Round(time.Microsecond), time.Duration(c.MaxP99))
+	}
+	errorRate := float64(r.FailedOps) / float64(r.TotalOps) * 100
+	if c.MaxErrorRate > 0 && errorRate > c.MaxErrorRate {
+		return fmt.Sprintf("error rate %.2f%% > %.2f%%", errorRate, c.MaxErrorRate)
+	}
+	return ""
+}
+
+func formatSearchLevel(mode string, level float64) string {
+	if mode == SearchRate {
+		return fmt.Sprintf("%.0f ops/s", level)
+	}
+	return fmt.Sprintf("%.0f workers", level)
+}
+
+func printCapacityReport(results []CapacityResult) {
+	printSection("Capacity Search Report")
+
+	for _, c := range results {
+		fmt.Println()
+		fmt.Printf("   %s%s%s (%s, search by %s)\n", Bold, c.Name, Reset, c.Workload, c.Mode)
+		fmt.Println("   ┌──────────────────┬───────────┬───────────┬───────────┬──────────┐")
+		fmt.Printf("   │ %-16s │ %-9s │ %-9s │ %-9s │ %-8s │\n", "Load Level", "Ops/Sec", "P99 Lat", "Errors%", "Status")
+		fmt.Println("   ├──────────────────┼───────────┼───────────┼───────────┼──────────┤")
+		for _, s := range c.Steps {
+			errorRate := 0.0
+			if s.Result.TotalOps > 0 {
+				errorRate = float64(s.Result.FailedOps) / float64(s.Result.TotalOps) * 100
+			}
+			status := "[OK]"
+			if !s.Passed {
+				status = "[LIMIT]"
+			}
+			fmt.Printf("   │ %-16s │ %9.2f │ %9s │ %8.2f%% │ %-8s │\n",
+				formatSearchLevel(c.Mode, s.Level), s.Result.OpsPerSecond, s.Result.P99Latency.Round(time.Microsecond).String(), errorRate, status)
+		}
+		fmt.Println("   └──────────────────┴───────────┴───────────┴───────────┴──────────┘")
+
+		if c.KneeLevel > 0 {
+			fmt.Printf("   [KNEE]    Max sustainable load: %s -> %.2f ops/sec, P99 %v\n",
+				formatSearchLevel(c.Mode, c.KneeLevel), c.KneeOps, c.KneeP99.Round(time.Microsecond))
+		} else {
+			fmt.Println("   [KNEE]    No load level stayed within the limits")
+		}
+		fmt.Printf("   [STOP]    %s\n", c.StopReason)
+	}
+}
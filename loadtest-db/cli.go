@@ -0,0 +1,872 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `Usage: loadtest-db <command> [flags]
+
+Commands:
+  run               Set up test tables, run the scenario and clean up (default)
+  replication-lag   Measure replication lag from PRIMARY to REPLICA
+  failover          Keep steady traffic running while a backend is stopped and report downtime
+  setup             Create and seed the test tables in a schema that is kept
+  cleanup           Drop the schema of an earlier 'setup' (-schema)
+  janitor           Drop the schemas of crashed runs
+  list-workloads    List the workloads available to scenario files
+
+Flags override the DB_*, PRIMARY_*, REPLICA_* and PROXY_* environment variables.
+Run 'loadtest-db <command> -h' for the flags of a command.
+`
+
+// runCLI dispatches a subcommand and returns the process exit code
+func runCLI(args []string) int {
+	cmd := "run"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+
+	cfg := loadConfig()
+	fs := flag.NewFlagSet("loadtest-db "+cmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: loadtest-db %s [flags]\n\nFlags:\n", cmd)
+		fs.PrintDefaults()
+	}
+
+	switch cmd {
+	case "run":
+		bindConnectionFlags(fs, &cfg)
+		bindReplicationFlags(fs, &cfg)
+		fs.StringVar(&cfg.ScenarioFile, "scenario", cfg.ScenarioFile, "scenario file, built-in default if empty (SCENARIO_FILE)")
+		fs.BoolVar(&cfg.EnableReplicationTest, "replication", cfg.EnableReplicationTest, "run the replication lag test after the load tests (ENABLE_REPLICATION_TEST)")
+		fs.DurationVar(&cfg.LagProbeInterval, "replication-probe-interval", cfg.LagProbeInterval, "with -replication, sample replication lag this often during the load tests, 0 to disable (REPLICATION_PROBE_INTERVAL)")
+		fs.BoolVar(&cfg.ReadOnly, "read-only", cfg.ReadOnly, "run only read workloads in read-only sessions against existing tables, no setup or cleanup (READ_ONLY)")
+		bindSeedFlags(fs, &cfg)
+		fs.Int64Var(&cfg.RandomSeed, "random-seed", cfg.RandomSeed, "seed of the random key and data choices, to repeat a run; new if 0 (RANDOM_SEED)")
+		fs.BoolVar(&cfg.KeepData, "keep-data", cfg.KeepData, "keep the seeded tables after the run and reuse them while the seed options match (KEEP_DATA)")
+		bindReportFlags(fs, &cfg)
+		fs.StringVar(&cfg.BaselineFile, "baseline", cfg.BaselineFile, "JSON results of a previous run to compare against (BASELINE_FILE)")
+		fs.Float64Var(&cfg.RegressionTolerance, "regression-tolerance", cfg.RegressionTolerance, "percent change that counts as a regression (REGRESSION_TOLERANCE)")
+		fs.BoolVar(&cfg.FailOnRegression, "fail-on-regression", cfg.FailOnRegression, "exit non-zero when a test regressed against the baseline (FAIL_ON_REGRESSION)")
+	case "replication-lag":
+		bindConnectionFlags(fs, &cfg)
+		bindReplicationFlags(fs, &cfg)
+		fs.Int64Var(&cfg.RandomSeed, "random-seed", cfg.RandomSeed, "seed of the ids of the test rows, to repeat a run; new if 0 (RANDOM_SEED)")
+		bindReportFlags(fs, &cfg)
+	case "failover":
+		bindConnectionFlags(fs, &cfg)
+		bindFailoverFlags(fs, &cfg)
+		fs.Int64Var(&cfg.RandomSeed, "random-seed", cfg.RandomSeed, "seed of the random choices, to repeat a run; new if 0 (RANDOM_SEED)")
+		bindReportFlags(fs, &cfg)
+	case "setup":
+		bindConnectionFlags(fs, &cfg)
+		bindSeedFlags(fs, &cfg)
+		fs.Int64Var(&cfg.RandomSeed, "random-seed", cfg.RandomSeed, "seed of the random seed data, to repeat a setup; new if 0 (RANDOM_SEED)")
+	case "cleanup":
+		bindConnectionFlags(fs, &cfg)
+	case "janitor":
+		bindConnectionFlags(fs, &cfg)
+		fs.DurationVar(&cfg.JanitorMaxAge, "max-age", cfg.JanitorMaxAge, "drop schemas of runs without a heartbeat for this long (JANITOR_MAX_AGE)")
+		fs.BoolVar(&cfg.JanitorDryRun, "dry-run", cfg.JanitorDryRun, "only list what would be dropped (JANITOR_DRY_RUN)")
+	case "list-workloads":
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		return exitUsage
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	// Keep stdout clean for the JSON report
+	if cfg.ResultsFile == "-" {
+		reportOutput = os.Stdout
+		os.Stdout = os.Stderr
+		log.SetOutput(os.Stderr)
+	}
+
+	switch cmd {
+	case "run":
+		return cmdRun(cfg)
+	case "replication-lag":
+		return cmdReplicationLag(cfg)
+	case "failover":
+		return cmdFailover(cfg)
+	case "setup":
+		return cmdSetup(cfg)
+	case "cleanup":
+		return cmdCleanup(cfg)
+	case "janitor":
+		return cmdJanitor(cfg)
+	default:
+		return cmdListWorkloads()
+	}
+}
+
+func bindConnectionFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.PrimaryHost, "host", cfg.PrimaryHost, "primary host (DB_HOST, PRIMARY_HOST)")
+	fs.StringVar(&cfg.PrimaryPort, "port", cfg.PrimaryPort, "primary port (DB_PORT, PRIMARY_PORT)")
+	fs.StringVar(&cfg.PrimaryUser, "user", cfg.PrimaryUser, "primary user (DB_USER, PRIMARY_USER)")
+	fs.Var(secretFlag{&cfg.PrimaryPassword}, "password", "primary password (DB_PASSWORD, PRIMARY_PASSWORD)")
+	fs.StringVar(&cfg.PrimaryDB, "dbname", cfg.PrimaryDB, "primary database (DB_NAME, PRIMARY_DB)")
+	fs.StringVar(&cfg.Schema, "schema", cfg.Schema, "schema for the test tables, loadtest_*; a new one per run if empty (LOADTEST_SCHEMA)")
+	fs.BoolVar(&cfg.AllowDestructive, "allow-destructive", cfg.AllowDestructive, "create and drop test tables even if the database has no loadtest.allow opt-in (ALLOW_DESTRUCTIVE)")
+
+	fs.StringVar(&cfg.ReplicaHosts, "replica-hosts", cfg.ReplicaHosts, "comma-separated replica host[:port] list (REPLICA_HOSTS)")
+	fs.StringVar(&cfg.ReplicaHost, "replica-host", cfg.ReplicaHost, "replica host, if -replica-hosts is not set (REPLICA_HOST)")
+	fs.StringVar(&cfg.ReplicaPort, "replica-port", cfg.ReplicaPort, "replica port (REPLICA_PORT)")
+	fs.StringVar(&cfg.ReplicaUser, "replica-user", cfg.ReplicaUser, "replica user (REPLICA_USER)")
+	fs.Var(secretFlag{&cfg.ReplicaPassword}, "replica-password", "replica password (REPLICA_PASSWORD)")
+	fs.StringVar(&cfg.ReplicaDB, "replica-dbname", cfg.ReplicaDB, "replica database (REPLICA_DB)")
+
+	fs.StringVar(&cfg.ProxyHost, "proxy-host", cfg.ProxyHost, "proxy host (PROXY_HOST)")
+	fs.StringVar(&cfg.ProxyPort, "proxy-port", cfg.ProxyPort, "proxy port (PROXY_PORT)")
+	fs.StringVar(&cfg.ProxyUser, "proxy-user", cfg.ProxyUser, "proxy user (PROXY_USER)")
+	fs.Var(secretFlag{&cfg.ProxyPassword}, "proxy-password", "proxy password (PROXY_PASSWORD)")
+	fs.StringVar(&cfg.ProxyDB, "proxy-dbname", cfg.ProxyDB, "proxy database (PROXY_DB)")
+	fs.Float64Var(&cfg.ReadWeightPrimary, "read-weight-primary", cfg.ReadWeightPrimary, "proxy read weight of PRIMARY, for the read split report (READ_WEIGHT_PRIMARY)")
+	fs.Float64Var(&cfg.ReadWeightReplica, "read-weight-replica", cfg.ReadWeightReplica, "proxy read weight of each replica, for the read split report (READ_WEIGHT_REPLICA)")
+	fs.StringVar(&cfg.LoadBalanceOnWrite, "load-balance-on-write", cfg.LoadBalanceOnWrite, "proxy disable_load_balance_on_write mode, if PGPOOL SHOW is not available (LOAD_BALANCE_ON_WRITE)")
+}
+
+// secretFlag is a string flag whose value is never shown in -h output
+type secretFlag struct{ p *string }
+
+func (f secretFlag) String() string { return "" }
+
+func (f secretFlag) Set(v string) error {
+	*f.p = v
+	return nil
+}
+
+func bindReportFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.ResultsFile, "json-out", cfg.ResultsFile, "write JSON results to this file, - for stdout (RESULTS_FILE)")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "serve live Prometheus metrics on this address, e.g. :9090 (METRICS_ADDR)")
+}
+
+// startMetrics starts the Prometheus endpoint if one is configured. The
+// registry is nil without one.
+func startMetrics(cfg Config) (*metricsRegistry, bool) {
+	if cfg.MetricsAddr == "" {
+		return nil, true
+	}
+	metrics, err := startMetricsServer(cfg.MetricsAddr)
+	if err != nil {
+		logError("Failed to start metrics endpoint", err)
+		return nil, false
+	}
+	logInfo("Metrics", "serving Prometheus metrics on "+cfg.MetricsAddr+"/metrics")
+	return metrics, true
+}
+
+func bindReplicationFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.DurationVar(&cfg.MaxReplicationP99, "max-replication-p99", cfg.MaxReplicationP99, "fail when P99 replication lag exceeds this (MAX_REPLICATION_P99)")
+	fs.IntVar(&cfg.ReplicationTestCount, "replication-count", cfg.ReplicationTestCount, "number of replication lag samples (REPLICATION_TEST_COUNT)")
+	fs.IntVar(&cfg.ReplicationMaxWait, "replication-max-wait", cfg.ReplicationMaxWait, "seconds to wait for a row to reach the replica (REPLICATION_MAX_WAIT)")
+}
+
+func bindSeedFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.IntVar(&cfg.SeedRows, "seed-rows", cfg.SeedRows, "rows seeded into loadtest_simple (SEED_ROWS)")
+	fs.IntVar(&cfg.SeedTimeseriesRows, "seed-timeseries-rows", cfg.SeedTimeseriesRows, "rows seeded into loadtest_timeseries (SEED_TIMESERIES_ROWS)")
+	fs.IntVar(&cfg.SeedDevices, "seed-devices", cfg.SeedDevices, "device ids in the seeded timeseries rows (SEED_DEVICES)")
+	fs.DurationVar(&cfg.SeedSpan, "seed-span", cfg.SeedSpan, "time span up to now covered by the seeded timeseries rows (SEED_SPAN)")
+	fs.DurationVar(&cfg.SeedChunkInterval, "seed-chunk-interval", cfg.SeedChunkInterval, "hypertable chunk interval, TimescaleDB default if 0 (SEED_CHUNK_INTERVAL)")
+	fs.IntVar(&cfg.SeedWorkers, "seed-workers", cfg.SeedWorkers, "parallel COPY connections used for seeding (SEED_WORKERS)")
+}
+
+func bindFailoverFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.FailoverTarget, "target", cfg.FailoverTarget, "primary or proxy, proxy if a proxy host is set (FAILOVER_TARGET)")
+	fs.DurationVar(&cfg.FailoverDuration, "duration", cfg.FailoverDuration, "how long to keep traffic running (FAILOVER_DURATION)")
+	fs.IntVar(&cfg.FailoverWorkers, "workers", cfg.FailoverWorkers, "concurrent read/write workers (FAILOVER_WORKERS)")
+	fs.DurationVar(&cfg.FailoverOpTimeout, "op-timeout", cfg.FailoverOpTimeout, "an operation taking longer counts as failed (FAILOVER_OP_TIMEOUT)")
+	fs.StringVar(&cfg.FailoverHook, "hook", cfg.FailoverHook, "shell command that disrupts a backend, e.g. 'docker stop replica' (FAILOVER_HOOK)")
+	fs.DurationVar(&cfg.FailoverHookDelay, "hook-delay", cfg.FailoverHookDelay, "run -hook this long after the start (FAILOVER_HOOK_DELAY)")
+	fs.StringVar(&cfg.FailoverRecoverHook, "recover-hook", cfg.FailoverRecoverHook, "shell command that restores the backend (FAILOVER_RECOVER_HOOK)")
+	fs.DurationVar(&cfg.FailoverRecoverDelay, "recover-delay", cfg.FailoverRecoverDelay, "run -recover-hook this long after -hook (FAILOVER_RECOVER_DELAY)")
+	fs.DurationVar(&cfg.FailoverMaxDowntime, "max-downtime", cfg.FailoverMaxDowntime, "fail when one window of unavailability is longer (FAILOVER_MAX_DOWNTIME)")
+}
+
+// cmdRun sets up the test tables, runs every test in the scenario and cleans up.
+// In read-only mode it runs only the read workloads, against existing tables.
+func cmdRun(cfg Config) int {
+	printBanner()
+	initRunSeed(cfg)
+	readOnlyMode = cfg.ReadOnly
+
+	metrics, ok := startMetrics(cfg)
+	if !ok {
+		return exitError
+	}
+
+	scenario, err := loadScenario(cfg.ScenarioFile)
+	if err != nil {
+		logError("Failed to load scenario", err)
+		return exitError
+	}
+
+	// Load the baseline up front so a bad path fails before the tests run
+	var baseline *Report
+	if cfg.BaselineFile != "" {
+		if baseline, err = loadBaseline(cfg.BaselineFile); err != nil {
+			logError("Failed to load baseline", err)
+			return exitError
+		}
+	}
+
+	schema, owned, err := resolveSchema(cfg)
+	if err != nil {
+		logError("Invalid schema", err)
+		return exitError
+	}
+	seed := cfg.seedOptions()
+	if readOnlyMode {
+		// Read the tables of an earlier 'setup' or '-keep-data' run; scripts and
+		// replays of production queries use the database's own search_path
+		schema = cfg.Schema
+		if !readOnlyTests(scenario) {
+			return exitError
+		}
+		if schema == "" && scenario.usesTestTables() {
+			schema = datasetSchema
+		}
+	} else if err := seed.validate(); err != nil {
+		logError("Invalid seed options", err)
+		return exitError
+	}
+
+	report := newReport("run")
+	report.Scenario = scenario.Name
+	report.Schema = schema
+	report.RandomSeed = runSeed
+	if !readOnlyMode {
+		report.Seed = &seed
+		report.Dataset = seed.fingerprint()
+		if err := scenario.applySeed(seed); err != nil {
+			logError("Scenario cannot run", err)
+			return exitError
+		}
+	}
+
+	// Connect to Primary
+	primaryDB, info, err := openDatabase("PRIMARY", cfg.PrimaryHost, cfg.PrimaryPort, cfg.PrimaryUser, cfg.PrimaryPassword, cfg.PrimaryDB, schema)
+	if err != nil {
+		return exitError
+	}
+	defer primaryDB.Close()
+	report.Databases = append(report.Databases, info)
+
+	targets := map[string]*sql.DB{TargetPrimary: primaryDB}
+	env := testEnv{metrics: metrics}
+
+	// Connect to Replicas (if configured)
+	var replicas []replicaConn
+	if cfg.EnableReplicationTest || scenario.usesReplica() {
+		replicas, err = openReplicas(cfg, schema, report)
+		for _, r := range replicas {
+			defer r.DB.Close()
+			targets[r.Name] = r.DB
+		}
+		if err != nil {
+			return exitError
+		}
+		if len(replicas) > 0 {
+			targets[TargetReplica] = replicas[0].DB
+		}
+	}
+
+	// Connect to Proxy (if configured)
+	if cfg.ProxyHost != "" && scenario.usesTarget(TargetProxy) {
+		proxyDB, info, err := openDatabase("PROXY", cfg.ProxyHost, cfg.ProxyPort, cfg.ProxyUser, cfg.ProxyPassword, cfg.ProxyDB, schema)
+		if err != nil {
+			return exitError
+		}
+		defer proxyDB.Close()
+		targets[TargetProxy] = proxyDB
+		report.Databases = append(report.Databases, info)
+		env.proxyWeights = readWeights{primary: cfg.ReadWeightPrimary, replica: cfg.ReadWeightReplica, replicas: len(cfg.replicaConfigs())}
+		if env.loadBalanceMode = detectLoadBalanceMode(proxyDB); env.loadBalanceMode == "" {
+			env.loadBalanceMode = cfg.LoadBalanceOnWrite
+		}
+		if env.loadBalanceMode != "" {
+			logInfo("Load Balance On Write", env.loadBalanceMode)
+		}
+	}
+
+	for _, t := range scenario.Tests {
+		if _, ok := targets[t.Target]; !ok {
+			logError("Scenario cannot run", fmt.Errorf("test %q targets %s but no %s host is configured", t.Name, t.Target, t.Target))
+			return exitError
+		}
+	}
+
+	// Setup test tables
+	var run *testRun
+	if readOnlyMode {
+		printSection("Read-Only Mode")
+		logInfo("Sessions", "default_transaction_read_only = on; no tables are created or dropped")
+		// search_path falls back to public, so check the schema itself holds the tables
+		if scenario.usesTestTables() {
+			exists, err := testTablesExist(primaryDB, schema)
+			if err != nil {
+				logError("Failed to look up the test tables", err)
+				return exitError
+			}
+			if !exists {
+				logError("Read-only mode needs existing test tables",
+					fmt.Errorf("schema %s does not hold them; create them with 'setup' and pass its -schema, or with 'run -keep-data'", schema))
+				return exitError
+			}
+			logSuccess("Using the existing test tables in schema " + schema)
+		}
+		if cfg.EnableReplicationTest {
+			logWarning("Replication lag test skipped: it writes to PRIMARY")
+			cfg.EnableReplicationTest = false
+		}
+	} else {
+		printSection("Setting Up Test Environment")
+		if !guardDestructive(primaryDB, cfg, schema) {
+			return exitError
+		}
+		// A schema the run did not create is kept, whatever it holds
+		if run, err = startRun(primaryDB, schema, "run", !owned); err != nil {
+			logError("Failed to create schema", err)
+			return exitError
+		}
+		// Without a fixed seed, a kept dataset is reused with the seed it was generated from
+		if cfg.KeepData && cfg.RandomSeed == 0 {
+			if s, ok, err := keptSeed(primaryDB, schema, seed); err == nil && ok && s != 0 && s != runSeed {
+				runSeed, seed.RandomSeed = s, s
+				report.RandomSeed = s
+				report.Dataset = seed.fingerprint()
+				logInfo("Random Seed", fmt.Sprintf("%d, the seed of the kept dataset (repeat this run with RANDOM_SEED=%d)", s, s))
+			}
+		}
+		seededAt, kept, err := keptDataset(primaryDB, schema, report.Dataset)
+		if err != nil {
+			logWarning("Failed to read the kept dataset, seeding again: " + err.Error())
+		}
+		existing := false
+		if !owned && !cfg.KeepData {
+			if existing, err = testTablesExist(primaryDB, schema); err != nil {
+				logError("Failed to look up the test tables", err)
+				run.finish(false)
+				return exitError
+			}
+		}
+		switch {
+		case cfg.KeepData && kept:
+			logSuccess(fmt.Sprintf("Reusing dataset %s in schema %s, seeded %v ago", report.Dataset, schema, time.Since(seededAt).Round(time.Second)))
+		case existing:
+			// Tables of an earlier 'setup' are used as they are, never reseeded
+			logSuccess("Using the existing test tables in schema " + schema)
+		default:
+			if cfg.KeepData {
+				logInfo("Dataset", fmt.Sprintf("no dataset %s in schema %s yet, seeding", report.Dataset, schema))
+			}
+			if err := setupTestTables(primaryDB, schema, seed); err != nil {
+				logError("Failed to setup test tables", err)
+				run.finish(owned)
+				return exitError
+			}
+			logSuccess("Test tables created in schema " + schema + "!")
+		}
+	}
+	if schema != "" {
+		dataEnd, err := datasetEnd(primaryDB, schema)
+		if err != nil {
+			logWarning("Failed to read the end of the seeded data, time windows end now: " + err.Error())
+		} else if !dataEnd.IsZero() {
+			scenario.applyDataEnd(dataEnd)
+			logInfo("Time Windows", fmt.Sprintf("end at the seeded data's end, %v ago", time.Since(dataEnd).Round(time.Second)))
+		}
+	}
+
+	// Sample replication lag in the background while the load tests run
+	if len(replicas) > 0 && cfg.EnableReplicationTest && cfg.LagProbeInterval > 0 {
+		env.lagProbe = startLagProbe(primaryDB, replicas, cfg.LagProbeInterval, cfg.ReplicationMaxWait, metrics)
+		logInfo("Lag Probe", fmt.Sprintf("sampling replication lag every %v during each test", cfg.LagProbeInterval))
+	}
+
+	// Run all load tests
+	results := []TestResult{}
+
+	printSection("Running Load Tests")
+	logInfo("Scenario", fmt.Sprintf("%s (%d tests)", scenario.Name, len(scenario.Tests)))
+	fmt.Println()
+
+	var capacity []CapacityResult
+	for _, t := range scenario.Tests {
+		if t.Search != nil {
+			c := runCapacitySearch(targets[t.Target], t, workloads[t.Workload], env)
+			for _, step := range c.Steps {
+				results = append(results, step.Result)
+			}
+			capacity = append(capacity, c)
+			continue
+		}
+		r := runTest(targets[t.Target], t, workloads[t.Workload], env)
+		if t.Assert != nil {
+			r.Assertions = t.Assert
+			r.Violations = t.Assert.check(r)
+			printViolations("SLO", r.Violations)
+		}
+		results = append(results, r)
+	}
+
+	if env.lagProbe != nil {
+		env.lagProbe.stop()
+	}
+
+	// Print load test report
+	printFinalReport(results)
+	for _, r := range results {
+		if r.ReplicationLag != nil {
+			printLagUnderLoadReport(results)
+			break
+		}
+	}
+	if len(capacity) > 0 {
+		printCapacityReport(capacity)
+	}
+	if baseline != nil {
+		report.Baseline = compareToBaseline(cfg.BaselineFile, baseline, results, cfg.RegressionTolerance)
+		printBaselineReport(report.Baseline)
+	}
+
+	// Run Replication Lag Test (if replica is configured)
+	if len(replicas) > 0 && cfg.EnableReplicationTest {
+		repResult := runReplicationSection(cfg, primaryDB, replicas, scenario.ReplicationAssert, metrics)
+		report.Replication = &repResult
+	}
+
+	passed := printSLOSummary(results, report.Replication)
+	if cfg.FailOnRegression && report.Baseline != nil && report.Baseline.Regressions > 0 {
+		logWarning(fmt.Sprintf("%d tests regressed against the baseline", report.Baseline.Regressions))
+		passed = false
+	}
+	report.Passed = passed
+
+	report.Tests = results
+	report.Capacity = capacity
+	saveErr := saveReport(cfg, report)
+
+	// Cleanup
+	if run != nil && !owned {
+		printSection("Cleanup")
+		run.finish(false)
+		if cfg.KeepData {
+			logInfo("Kept", fmt.Sprintf("schema %s with dataset %s for the next -keep-data run", schema, report.Dataset))
+		} else {
+			logInfo("Kept", fmt.Sprintf("schema %s; drop it with 'cleanup -schema %s'", schema, schema))
+		}
+	} else if run != nil {
+		printSection("Cleanup")
+		if err := run.finish(true); err != nil {
+			logWarning("Failed to drop schema " + schema + ": " + err.Error())
+		} else {
+			logSuccess("Schema " + schema + " dropped successfully!")
+		}
+	}
+
+	printFooter()
+	return exitCode(saveErr, passed)
+}
+
+// cmdReplicationLag runs only the replication lag test
+func cmdReplicationLag(cfg Config) int {
+	printBanner()
+	initRunSeed(cfg)
+
+	if len(cfg.replicaConfigs()) == 0 {
+		logError("Replication lag test needs a replica", fmt.Errorf("set REPLICA_HOSTS, REPLICA_HOST or -replica-hosts"))
+		return exitError
+	}
+
+	metrics, ok := startMetrics(cfg)
+	if !ok {
+		return exitError
+	}
+
+	schema, owned, err := resolveSchema(cfg)
+	if err != nil {
+		logError("Invalid schema", err)
+		return exitError
+	}
+
+	report := newReport("replication-lag")
+	report.Schema = schema
+	report.RandomSeed = runSeed
+
+	primaryDB, info, err := openDatabase("PRIMARY", cfg.PrimaryHost, cfg.PrimaryPort, cfg.PrimaryUser, cfg.PrimaryPassword, cfg.PrimaryDB, schema)
+	if err != nil {
+		return exitError
+	}
+	defer primaryDB.Close()
+	report.Databases = append(report.Databases, info)
+
+	replicas, err := openReplicas(cfg, schema, report)
+	for _, r := range replicas {
+		defer r.DB.Close()
+	}
+	if err != nil {
+		return exitError
+	}
+
+	if !guardDestructive(primaryDB, cfg, schema) {
+		return exitError
+	}
+	run, err := startRun(primaryDB, schema, "replication-lag", false)
+	if err != nil {
+		logError("Failed to create schema", err)
+		return exitError
+	}
+	created, err := ensureReplicationTable(primaryDB, schema)
+	if err != nil {
+		logError("Failed to create replication table", err)
+		run.finish(owned)
+		return exitError
+	}
+
+	repResult := runReplicationSection(cfg, primaryDB, replicas, nil, metrics)
+	report.Replication = &repResult
+	report.Passed = printSLOSummary(nil, report.Replication)
+	saveErr := saveReport(cfg, report)
+
+	// Leave the table alone if it belongs to an earlier 'setup'
+	if err := run.finish(owned); err != nil {
+		logWarning("Failed to drop schema " + schema + ": " + err.Error())
+	}
+	if created && !owned {
+		if _, err := primaryDB.Exec(`DROP TABLE IF EXISTS ` + qualify(schema, "loadtest_replication")); err != nil {
+			logWarning("Failed to drop replication table: " + err.Error())
+		}
+	}
+
+	printFooter()
+	return exitCode(saveErr, report.Passed)
+}
+
+// cmdFailover keeps read/write traffic on the primary or proxy while a backend is
+// disrupted, by hand or by a hook command, and reports the downtime it caused
+func cmdFailover(cfg Config) int {
+	printBanner()
+	initRunSeed(cfg)
+
+	target := cfg.FailoverTarget
+	if target == "" {
+		target = TargetPrimary
+		if cfg.ProxyHost != "" {
+			target = TargetProxy
+		}
+	}
+	if target != TargetPrimary && target != TargetProxy {
+		logError("Invalid failover target", fmt.Errorf("%q (use primary or proxy)", target))
+		return exitError
+	}
+	if cfg.FailoverWorkers <= 0 || cfg.FailoverDuration <= 0 {
+		logError("Invalid failover options", fmt.Errorf("workers and duration must be positive"))
+		return exitError
+	}
+	if target == TargetProxy && cfg.ProxyHost == "" {
+		logError("Failover test needs a proxy", fmt.Errorf("set PROXY_HOST or -proxy-host"))
+		return exitError
+	}
+
+	metrics, ok := startMetrics(cfg)
+	if !ok {
+		return exitError
+	}
+
+	schema, owned, err := resolveSchema(cfg)
+	if err != nil {
+		logError("Invalid schema", err)
+		return exitError
+	}
+
+	report := newReport("failover")
+	report.Schema = schema
+	report.RandomSeed = runSeed
+
+	var db *sql.DB
+	var info DatabaseInfo
+	if target == TargetProxy {
+		db, info, err = openDatabase("PROXY", cfg.ProxyHost, cfg.ProxyPort, cfg.ProxyUser, cfg.ProxyPassword, cfg.ProxyDB, schema)
+	} else {
+		db, info, err = openDatabase("PRIMARY", cfg.PrimaryHost, cfg.PrimaryPort, cfg.PrimaryUser, cfg.PrimaryPassword, cfg.PrimaryDB, schema)
+	}
+	if err != nil {
+		return exitError
+	}
+	defer db.Close()
+	report.Databases = append(report.Databases, info)
+
+	printSection("Setting Up Failover Test")
+	if !guardDestructive(db, cfg, schema) {
+		return exitError
+	}
+	run, err := startRun(db, schema, "failover", false)
+	if err != nil {
+		logError("Failed to create schema", err)
+		return exitError
+	}
+	if err := setupFailoverTable(db, schema); err != nil {
+		logError("Failed to create failover table", err)
+		run.finish(owned)
+		return exitError
+	}
+	logSuccess("Failover table created successfully!")
+
+	opts := FailoverOptions{
+		Duration:     cfg.FailoverDuration,
+		Workers:      cfg.FailoverWorkers,
+		OpTimeout:    cfg.FailoverOpTimeout,
+		Hook:         cfg.FailoverHook,
+		HookDelay:    cfg.FailoverHookDelay,
+		RecoverHook:  cfg.FailoverRecoverHook,
+		RecoverDelay: cfg.FailoverRecoverDelay,
+		MaxDowntime:  cfg.FailoverMaxDowntime,
+	}
+
+	printSection("Running Failover Test")
+	fmt.Println()
+	logInfo("Traffic", fmt.Sprintf("%d workers writing and reading back rows through %s for %v", opts.Workers, strings.ToUpper(target), opts.Duration))
+	if opts.Hook != "" {
+		logInfo("Disrupt Hook", fmt.Sprintf("%s (after %v)", opts.Hook, opts.HookDelay))
+		if opts.RecoverHook != "" {
+			logInfo("Recover Hook", fmt.Sprintf("%s (%v later)", opts.RecoverHook, opts.RecoverDelay))
+		}
+	} else {
+		logInfo("Disruption", "stop a backend now (e.g. docker stop <container>); Ctrl-C ends the test early")
+	}
+	fmt.Println()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result := runFailoverTest(ctx, db, target, opts, metrics)
+	stop()
+
+	printFailoverReport(result, opts)
+	report.Failover = &result
+	report.Passed = result.passed(opts)
+	saveErr := saveReport(cfg, report)
+
+	printSection("Cleanup")
+	err = run.finish(owned)
+	if err == nil && !owned {
+		_, err = db.Exec(`DROP TABLE IF EXISTS ` + qualify(schema, "loadtest_failover"))
+	}
+	if err != nil {
+		logWarning("Failed to drop failover table: " + err.Error())
+	} else {
+		logSuccess("Failover table cleaned up successfully!")
+	}
+
+	printFooter()
+	return exitCode(saveErr, report.Passed)
+}
+
+// openReplicas connects to every configured replica and adds them to the report.
+// On error the replicas opened so far are returned so the caller can close them.
+func openReplicas(cfg Config, schema string, report *Report) ([]replicaConn, error) {
+	var replicas []replicaConn
+	for _, rc := range cfg.replicaConfigs() {
+		db, info, err := openDatabase(strings.ToUpper(rc.Name), rc.Host, rc.Port, cfg.ReplicaUser, cfg.ReplicaPassword, cfg.ReplicaDB, schema)
+		if err != nil {
+			return replicas, err
+		}
+		replicas = append(replicas, replicaConn{Name: rc.Name, Host: rc.Host, DB: db})
+		report.Databases = append(report.Databases, info)
+	}
+	return replicas, nil
+}
+
+// runReplicationSection runs and reports the replication lag test. MAX_REPLICATION_P99
+// takes precedence over the P99 limit in assert.
+func runReplicationSection(cfg Config, primaryDB *sql.DB, replicas []replicaConn, assert *ReplicationAssertions, metrics *metricsRegistry) ReplicationResult {
+	printSection("Replication Lag Test")
+	fmt.Println()
+	logInfo("Test Description", "Write to PRIMARY, measure time until data appears on REPLICA")
+	if len(replicas) > 1 {
+		logInfo("Replicas", fmt.Sprintf("%d, polled concurrently after each write", len(replicas)))
+	}
+	fmt.Println()
+
+	repResult := runReplicationLagTest(primaryDB, replicas, cfg.ReplicationTestCount, cfg.ReplicationMaxWait, metrics)
+	printReplicationReport(repResult)
+
+	if cfg.MaxReplicationP99 > 0 {
+		a := ReplicationAssertions{}
+		if assert != nil {
+			a = *assert
+		}
+		a.MaxP99Lag = Duration(cfg.MaxReplicationP99)
+		assert = &a
+	}
+	if assert.isSet() {
+		repResult.Assertions = assert
+		repResult.Violations = assert.check(repResult)
+		printViolations("Replication SLO", repResult.Violations)
+	}
+	return repResult
+}
+
+// cmdSetup creates and seeds the test tables in a schema that is left in place
+// for later commands
+func cmdSetup(cfg Config) int {
+	printBanner()
+	initRunSeed(cfg)
+
+	schema, owned, err := resolveSchema(cfg)
+	if err != nil {
+		logError("Invalid schema", err)
+		return exitError
+	}
+	seed := cfg.seedOptions()
+	if err := seed.validate(); err != nil {
+		logError("Invalid seed options", err)
+		return exitError
+	}
+
+	primaryDB, _, err := openDatabase("PRIMARY", cfg.PrimaryHost, cfg.PrimaryPort, cfg.PrimaryUser, cfg.PrimaryPassword, cfg.PrimaryDB, schema)
+	if err != nil {
+		return exitError
+	}
+	defer primaryDB.Close()
+
+	printSection("Setting Up Test Environment")
+	if !guardDestructive(primaryDB, cfg, schema) {
+		return exitError
+	}
+	run, err := startRun(primaryDB, schema, "setup", true)
+	if err != nil {
+		logError("Failed to create schema", err)
+		return exitError
+	}
+	if err := setupTestTables(primaryDB, schema, seed); err != nil {
+		logError("Failed to setup test tables", err)
+		run.finish(owned)
+		return exitError
+	}
+	run.finish(false)
+	logSuccess("Test tables created in schema " + schema + "!")
+	logInfo("Next", "pass -schema "+schema+" (LOADTEST_SCHEMA) to use or clean up these tables")
+	return exitOK
+}
+
+// cmdCleanup drops the schema of an earlier 'setup'
+func cmdCleanup(cfg Config) int {
+	printBanner()
+
+	if cfg.Schema == "" {
+		logError("Cleanup needs a schema", fmt.Errorf("set -schema or LOADTEST_SCHEMA; 'janitor' removes the schemas of crashed runs"))
+		return exitError
+	}
+	if err := validSchemaName(cfg.Schema); err != nil {
+		logError("Invalid schema", err)
+		return exitError
+	}
+
+	primaryDB, _, err := openDatabase("PRIMARY", cfg.PrimaryHost, cfg.PrimaryPort, cfg.PrimaryUser, cfg.PrimaryPassword, cfg.PrimaryDB, "")
+	if err != nil {
+		return exitError
+	}
+	defer primaryDB.Close()
+
+	printSection("Cleanup")
+	if !guardDestructive(primaryDB, cfg, "") {
+		return exitError
+	}
+	if err := dropSchema(primaryDB, cfg.Schema); err != nil {
+		logError("Failed to drop schema "+cfg.Schema, err)
+		return exitError
+	}
+	logSuccess("Schema " + cfg.Schema + " dropped successfully!")
+	return exitOK
+}
+
+// cmdJanitor drops the schemas of runs that crashed or were killed before their cleanup
+func cmdJanitor(cfg Config) int {
+	printBanner()
+
+	primaryDB, _, err := openDatabase("PRIMARY", cfg.PrimaryHost, cfg.PrimaryPort, cfg.PrimaryUser, cfg.PrimaryPassword, cfg.PrimaryDB, "")
+	if err != nil {
+		return exitError
+	}
+	defer primaryDB.Close()
+
+	printSection("Janitor")
+	if !guardDestructive(primaryDB, cfg, "") {
+		return exitError
+	}
+	if err := runJanitor(primaryDB, cfg.JanitorMaxAge, cfg.JanitorDryRun); err != nil {
+		logError("Janitor failed", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// guardDestructive checks that db opted in to load tests that create and drop
+// tables and, if schema is set, that it holds no objects of someone else
+func guardDestructive(db *sql.DB, cfg Config, schema string) bool {
+	how, err := checkDestructiveAllowed(db, cfg)
+	if err != nil {
+		logError("Refusing to create or drop tables", err)
+		return false
+	}
+	logInfo("Opt-In", how)
+	if schema == "" {
+		return true
+	}
+	if err := checkCollisions(db, schema); err != nil {
+		logError("Refusing to use schema "+schema, err)
+		return false
+	}
+	return true
+}
+
+// readOnlyTests drops the tests of workloads that write from a read-only run
+func readOnlyTests(scenario *Scenario) bool {
+	var tests []ScenarioTest
+	for _, t := range scenario.Tests {
+		if isReadOnly(workloads[t.Workload], t.Params) {
+			tests = append(tests, t)
+		} else {
+			logWarning(fmt.Sprintf("Read-only mode: skipping %q (%s writes)", t.Name, t.Workload))
+		}
+	}
+	if len(tests) == 0 {
+		logError("Scenario cannot run", fmt.Errorf("read-only mode: every test writes"))
+		return false
+	}
+	scenario.Tests = tests
+	return true
+}
+
+func cmdListWorkloads() int {
+	names := make([]string, 0, len(workloads))
+	for name := range workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%-20s %s\n", name, workloads[name].Description())
+	}
+	return exitOK
+}
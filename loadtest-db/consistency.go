@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// Read-your-writes checks, from most to least protected by Pgpool-II
+const (
+	CheckInTransaction    = "in_transaction"    // INSERT then SELECT inside one transaction
+	CheckAfterTransaction = "after_transaction" // INSERT in a committed transaction, then SELECT on the same connection
+	CheckSameSession      = "same_session"      // autocommit INSERT, then SELECT on the same connection
+	CheckNewSession       = "new_session"       // INSERT on one connection, SELECT on another
+)
+
+var readYourWritesChecks = []string{CheckInTransaction, CheckAfterTransaction, CheckSameSession, CheckNewSession}
+
+// ReadYourWritesResult counts reads that did not see a write made just before
+type ReadYourWritesResult struct {
+	LoadBalanceMode string             `json:"load_balance_mode"`
+	Checks          []ConsistencyCheck `json:"checks"`
+	Passed          bool               `json:"passed"` // no stale reads in a check the mode protects
+}
+
+// ConsistencyCheck is the outcome of one kind of read-your-writes check
+type ConsistencyCheck struct {
+	Name       string  `json:"name"`
+	Reads      int64   `json:"reads"`
+	StaleReads int64   `json:"stale_reads"`
+	StalePct   float64 `json:"stale_pct"`
+	StandbyHit int64   `json:"standby_reads"` // reads served by a standby
+	Protected  bool    `json:"protected"`     // the load balance mode should prevent stale reads
+}
+
+// readYourWritesTracker counts the read-your-writes checks of the running test.
+// mode is the disable_load_balance_on_write setting of the proxy, "" if unknown.
+type readYourWritesTracker struct {
+	mode   string
+	mu     sync.Mutex
+	checks map[string]*ConsistencyCheck
+}
+
+func newReadYourWritesTracker(mode string) *readYourWritesTracker {
+	return &readYourWritesTracker{mode: mode, checks: map[string]*ConsistencyCheck{}}
+}
+
+func (t *readYourWritesTracker) record(check string, stale, standby bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.checks[check]
+	if !ok {
+		c = &ConsistencyCheck{Name: check}
+		t.checks[check] = c
+	}
+	c.Reads++
+	if stale {
+		c.StaleReads++
+	}
+	if standby {
+		c.StandbyHit++
+	}
+}
+
+// result returns nil if the test ran no read-your-writes checks
+func (t *readYourWritesTracker) result() *ReadYourWritesResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.checks) == 0 {
+		return nil
+	}
+
+	result := &ReadYourWritesResult{LoadBalanceMode: t.mode, Passed: true}
+	for _, name := range readYourWritesChecks {
+		c, ok := t.checks[name]
+		if !ok {
+			continue
+		}
+		check := *c
+		check.StalePct = float64(check.StaleReads) / float64(check.Reads) * 100
+		check.Protected = protectedByMode(t.mode, name)
+		if check.Protected && check.StaleReads > 0 {
+			result.Passed = false
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	return result
+}
+
+// violations lists the checks the load balance mode should protect that still
+// read stale data
+func (r *ReadYourWritesResult) violations() []string {
+	var violations []string
+	for _, c := range r.Checks {
+		if c.Protected && c.StaleReads > 0 {
+			violations = append(violations, fmt.Sprintf("%d of %d %s reads stale under %s", c.StaleReads, c.Reads, c.Name, r.LoadBalanceMode))
+		}
+	}
+	return violations
+}
+
+// protectedByMode reports whether Pgpool-II's disable_load_balance_on_write mode
+// keeps a read on the primary in the given check. A read on another session is
+// never protected.
+func protectedByMode(mode, check string) bool {
+	switch check {
+	case CheckInTransaction:
+		return mode == "transaction" || mode == "trans_transaction" || mode == "always" || mode == "dml_adaptive"
+	case CheckAfterTransaction:
+		return mode == "trans_transaction" || mode == "always"
+	case CheckSameSession:
+		return mode == "always"
+	}
+	return false
+}
+
+// detectLoadBalanceMode asks Pgpool-II for disable_load_balance_on_write. It
+// returns "" when db is not a Pgpool-II node.
+func detectLoadBalanceMode(db *sql.DB) string {
+	var mode string
+	if err := db.QueryRow(`PGPOOL SHOW disable_load_balance_on_write`).Scan(&mode); err != nil {
+		return ""
+	}
+	return mode
+}
+
+func init() {
+	registerWorkload("read_your_writes", funcWorkload{"INSERT then immediate read-back, counting stale reads (use with target proxy)",
+		WorkloadParams{}, testReadYourWrites, false})
+}
+
+// rowQuerier is satisfied by *sql.DB, *sql.Conn and *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// testReadYourWrites inserts a row and reads it back straight away through a
+// randomly chosen path. Pgpool-II tracks writes per session, so the write and
+// the read share one connection except in the new_session check.
+func testReadYourWrites(db *sql.DB, w *Worker) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	check := readYourWritesChecks[w.Rand.Intn(len(readYourWritesChecks))]
+	insert := `INSERT INTO loadtest_simple (data, value) VALUES ($1, $2) RETURNING id`
+	data := payload(w, "ryw")
+	value := w.Rand.Intn(10000)
+
+	var id int64
+	var found, standby bool
+	switch check {
+	case CheckInTransaction, CheckAfterTransaction:
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := tx.QueryRowContext(ctx, insert, data, value).Scan(&id); err != nil {
+			return err
+		}
+		if check == CheckInTransaction {
+			if found, standby, err = readBack(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if check == CheckAfterTransaction {
+			if found, standby, err = readBack(ctx, conn, id); err != nil {
+				return err
+			}
+		}
+	case CheckSameSession:
+		if err := conn.QueryRowContext(ctx, insert, data, value).Scan(&id); err != nil {
+			return err
+		}
+		if found, standby, err = readBack(ctx, conn, id); err != nil {
+			return err
+		}
+	default:
+		if err := conn.QueryRowContext(ctx, insert, data, value).Scan(&id); err != nil {
+			return err
+		}
+		// conn is still held, so db hands out a different connection
+		if found, standby, err = readBack(ctx, db, id); err != nil {
+			return err
+		}
+	}
+
+	w.readYourWrites.record(check, !found, standby)
+	return nil
+}
+
+func readBack(ctx context.Context, q rowQuerier, id int64) (found, standby bool, err error) {
+	err = q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM loadtest_simple WHERE id = $1), pg_is_in_recovery()`, id).
+		Scan(&found, &standby)
+	return found, standby, err
+}
+
+func printReadYourWrites(result *ReadYourWritesResult) {
+	fmt.Println()
+	mode := result.LoadBalanceMode
+	if mode == "" {
+		mode = "unknown"
+	}
+	fmt.Printf("   Read-your-writes (disable_load_balance_on_write = %s):\n", mode)
+	fmt.Println("   ┌────────────────────┬────────────┬────────────┬──────────┬────────────┬───────────┐")
+	fmt.Printf("   │ %-18s │ %-10s │ %-10s │ %-8s │ %-10s │ %-9s │\n", "Check", "Reads", "Stale", "Stale%", "On Standby", "Protected")
+	fmt.Println("   ├────────────────────┼────────────┼────────────┼──────────┼────────────┼───────────┤")
+	for _, c := range result.Checks {
+		protected := "no"
+		if c.Protected {
+			protected = "yes"
+		}
+		fmt.Printf("   │ %-18s │ %10d │ %10d │ %7.2f%% │ %10d │ %-9s │\n", c.Name, c.Reads, c.StaleReads, c.StalePct, c.StandbyHit, protected)
+	}
+	fmt.Println("   └────────────────────┴────────────┴────────────┴──────────┴────────────┴───────────┘")
+
+	if result.LoadBalanceMode == "" {
+		fmt.Printf("   %s[WARN]%s Load balance mode unknown; PGPOOL SHOW failed and LOAD_BALANCE_ON_WRITE is not set\n", Yellow, Reset)
+		return
+	}
+	if result.Passed {
+		fmt.Printf("   %s[OK]%s No stale reads where %s should prevent them\n", Green, Reset, result.LoadBalanceMode)
+		return
+	}
+	for _, c := range result.Checks {
+		if c.Protected && c.StaleReads > 0 {
+			fmt.Printf("   %s[FAIL]%s %s: %d stale reads despite disable_load_balance_on_write = %s\n",
+				Red, Reset, c.Name, c.StaleReads, result.LoadBalanceMode)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Key distributions: how workloads choose the row id or device to touch
+const (
+	DistUniform    = "uniform"    // every key equally likely
+	DistZipfian    = "zipfian"    // a few keys get most of the traffic, key 1 the most (skew)
+	DistHotspot    = "hotspot"    // hot_ops of the operations go to the first hot_keys of the keys
+	DistLatest     = "latest"     // zipfian towards the highest keys, the newest rows
+	DistSequential = "sequential" // each worker walks the keys in order
+)
+
+// Distribution defaults where a test leaves the parameters unset
+const (
+	defaultSkew    = 0.99
+	defaultHotKeys = 0.2
+	defaultHotOps  = 0.8
+)
+
+func isDistribution(name string) bool {
+	switch name {
+	case "", DistUniform, DistZipfian, DistHotspot, DistLatest, DistSequential:
+		return true
+	}
+	return false
+}
+
+// describeDistribution names the key distribution of params with its parameters
+func describeDistribution(p WorkloadParams) string {
+	switch p.Distribution {
+	case DistZipfian, DistLatest:
+		return fmt.Sprintf("%s (skew %g)", p.Distribution, orDefault(p.Skew, defaultSkew))
+	case DistHotspot:
+		return fmt.Sprintf("hotspot (%.0f%% of operations on %.0f%% of keys)", orDefault(p.HotOps, defaultHotOps)*100, orDefault(p.HotKeys, defaultHotKeys)*100)
+	case "":
+		return DistUniform
+	}
+	return p.Distribution
+}
+
+// orDefault returns *v, or def if v is unset
+func orDefault(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// ratio returns a pointer to v, for setting the ratio fields of WorkloadParams
+func ratio(v float64) *float64 {
+	return &v
+}
+
+// keyChooser picks keys in 1..n for one worker
+type keyChooser struct {
+	dist   string
+	n      int
+	zipf   *zipfian
+	hotN   int
+	hotOps float64
+	next   int // sequential position
+}
+
+func newKeyChooser(p WorkloadParams, n, worker int) *keyChooser {
+	k := &keyChooser{dist: p.Distribution, n: n}
+	switch p.Distribution {
+	case DistZipfian, DistLatest:
+		k.zipf = newZipfian(n, orDefault(p.Skew, defaultSkew))
+	case DistHotspot:
+		k.hotN = max(1, int(float64(n)*orDefault(p.HotKeys, defaultHotKeys)))
+		k.hotOps = orDefault(p.HotOps, defaultHotOps)
+	case DistSequential:
+		// Spread the workers over the key range so they do not read the same rows in lockstep
+		k.next = worker * 7919 % n
+	}
+	return k
+}
+
+func (k *keyChooser) pick(r *rand.Rand) int {
+	switch k.dist {
+	case DistZipfian:
+		return k.zipf.next(r) + 1
+	case DistLatest:
+		return k.n - k.zipf.next(r)
+	case DistHotspot:
+		if k.hotN >= k.n || r.Float64() < k.hotOps {
+			return r.Intn(k.hotN) + 1
+		}
+		return k.hotN + r.Intn(k.n-k.hotN) + 1
+	case DistSequential:
+		key := k.next + 1
+		k.next = (k.next + 1) % k.n
+		return key
+	}
+	return r.Intn(k.n) + 1
+}
+
+// key returns a key in 1..n drawn from the worker's key distribution
+func (w *Worker) key(n int) int {
+	k, ok := w.keys[n]
+	if !ok {
+		if w.keys == nil {
+			w.keys = map[int]*keyChooser{}
+		}
+		k = newKeyChooser(w.Params, n, w.ID)
+		w.keys[n] = k
+	}
+	return k.pick(w.Rand)
+}
+
+// device returns a device id in device_0..device_N-1 drawn from the worker's key distribution
+func (w *Worker) device() string {
+	return fmt.Sprintf("device_%d", w.key(w.Params.Devices)-1)
+}
+
+// zipfian draws 0..n-1 with probability proportional to 1/(i+1)^theta, using
+// the method of Gray et al., "Quickly Generating Billion-Record Synthetic
+// Databases" (as in YCSB). Unlike math/rand's Zipf it accepts theta below 1.
+type zipfian struct {
+	n     int
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+func newZipfian(n int, theta float64) *zipfian {
+	zetan := zeta(n, theta)
+	zeta2 := zeta(2, theta)
+	return &zipfian{
+		n:     n,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta2/zetan),
+	}
+}
+
+func (z *zipfian) next(r *rand.Rand) int {
+	if z.n == 1 {
+		return 0
+	}
+	u := r.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+math.Pow(0.5, z.theta) {
+		return 1
+	}
+	return min(int(float64(z.n)*math.Pow(z.eta*u-z.eta+1, z.alpha)), z.n-1)
+}
+
+type zetaKey struct {
+	n     int
+	theta float64
+}
+
+// zetas caches zeta(n, theta): it is a sum over every key, and every worker of
+// a test needs the same one
+var zetas = struct {
+	sync.Mutex
+	m map[zetaKey]float64
+}{m: map[zetaKey]float64{}}
+
+func zeta(n int, theta float64) float64 {
+	zetas.Lock()
+	defer zetas.Unlock()
+	if z, ok := zetas.m[zetaKey{n, theta}]; ok {
+		return z
+	}
+	var sum float64
+	for i := 1; i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), theta)
+	}
+	zetas.m[zetaKey{n, theta}] = sum
+	return sum
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const distributionDraws = 200000
+
+// share returns the fraction of draws of k over keys 1..n for which in is true
+func share(k *keyChooser, r *rand.Rand, in func(key int) bool) float64 {
+	hits := 0
+	for i := 0; i < distributionDraws; i++ {
+		if in(k.pick(r)) {
+			hits++
+		}
+	}
+	return float64(hits) / distributionDraws
+}
+
+func TestZipfianFirstKeyShare(t *testing.T) {
+	for _, theta := range []float64{0.5, 0.8, 0.99} {
+		n := 1000
+		want := 1 / zeta(n, theta)
+		k := newKeyChooser(WorkloadParams{Distribution: DistZipfian, Skew: ratio(theta)}, n, 0)
+		got := share(k, rand.New(rand.NewSource(1)), func(key int) bool { return key == 1 })
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("zipfian skew %g: key 1 drawn %.3f of the time, want %.3f", theta, got, want)
+		}
+	}
+}
+
+func TestZipfianSkewOrdersKeys(t *testing.T) {
+	k := newKeyChooser(WorkloadParams{Distribution: DistZipfian}, 100, 0)
+	r := rand.New(rand.NewSource(2))
+	counts := make([]int, 101)
+	for i := 0; i < distributionDraws; i++ {
+		counts[k.pick(r)]++
+	}
+	if !(counts[1] > counts[2] && counts[2] > counts[10] && counts[10] > counts[100]) {
+		t.Errorf("zipfian counts of keys 1, 2, 10, 100 = %d, %d, %d, %d, want decreasing", counts[1], counts[2], counts[10], counts[100])
+	}
+}
+
+func TestLatestFavorsHighestKey(t *testing.T) {
+	n := 1000
+	k := newKeyChooser(WorkloadParams{Distribution: DistLatest}, n, 0)
+	want := 1 / zeta(n, defaultSkew)
+	got := share(k, rand.New(rand.NewSource(3)), func(key int) bool { return key == n })
+	if math.Abs(got-want) > 0.01 {
+		t.Errorf("latest: key %d drawn %.3f of the time, want %.3f", n, got, want)
+	}
+}
+
+func TestHotspotShare(t *testing.T) {
+	tests := []struct {
+		hotKeys, hotOps *float64
+		hotN            int
+		hotShare        float64
+	}{
+		{nil, nil, 200, 0.8}, // defaults: 80% of operations on 20% of keys
+		{ratio(0.1), ratio(0.9), 100, 0.9},
+		{ratio(0.5), ratio(0.5), 500, 0.5},
+		{ratio(0.3), ratio(0), 300, 0}, // an explicit 0 is not the default
+	}
+	for _, tt := range tests {
+		k := newKeyChooser(WorkloadParams{Distribution: DistHotspot, HotKeys: tt.hotKeys, HotOps: tt.hotOps}, 1000, 0)
+		if k.hotN != tt.hotN {
+			t.Errorf("hot_keys %g: %d hot keys, want %d", orDefault(tt.hotKeys, defaultHotKeys), k.hotN, tt.hotN)
+		}
+		got := share(k, rand.New(rand.NewSource(4)), func(key int) bool { return key <= tt.hotN })
+		if math.Abs(got-tt.hotShare) > 0.01 {
+			t.Errorf("hot_ops %g: %.3f of operations on hot keys, want %.3f", orDefault(tt.hotOps, defaultHotOps), got, tt.hotShare)
+		}
+	}
+}
+
+func TestSequentialWalksKeys(t *testing.T) {
+	k := newKeyChooser(WorkloadParams{Distribution: DistSequential}, 5, 0)
+	r := rand.New(rand.NewSource(5))
+	for i, want := range []int{1, 2, 3, 4, 5, 1, 2} {
+		if got := k.pick(r); got != want {
+			t.Fatalf("pick %d = %d, want %d", i, got, want)
+		}
+	}
+
+	// Other workers start elsewhere in the range
+	if a, b := newKeyChooser(WorkloadParams{Distribution: DistSequential}, 1000, 1).pick(r),
+		newKeyChooser(WorkloadParams{Distribution: DistSequential}, 1000, 2).pick(r); a == b || a == 1 {
+		t.Errorf("workers 1 and 2 start at keys %d and %d, want distinct starts away from 1", a, b)
+	}
+}
+
+func TestPicksStayInRange(t *testing.T) {
+	dists := []string{"", DistUniform, DistZipfian, DistHotspot, DistLatest, DistSequential}
+	for _, dist := range dists {
+		for _, n := range []int{1, 2, 3, 7, 1000} {
+			for worker := 0; worker < 3; worker++ {
+				k := newKeyChooser(WorkloadParams{Distribution: dist}, n, worker)
+				r := rand.New(rand.NewSource(int64(n*10 + worker)))
+				for i := 0; i < 10000; i++ {
+					if key := k.pick(r); key < 1 || key > n {
+						t.Fatalf("%q over %d keys, worker %d: picked %d", dist, n, worker, key)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWorkerDevice(t *testing.T) {
+	w := &Worker{ID: 0, Rand: rand.New(rand.NewSource(6)), Params: WorkloadParams{Devices: 3, Distribution: DistSequential}}
+	for i, want := range []string{"device_0", "device_1", "device_2", "device_0"} {
+		if got := w.device(); got != want {
+			t.Fatalf("device %d = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestWorkloadParamsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		params WorkloadParams
+		ok     bool
+	}{
+		{"zero", WorkloadParams{}, true},
+		{"all set", WorkloadParams{BatchSize: 10, KeyRange: 1000, ReadRatio: ratio(0.7), Devices: 10, Distribution: DistZipfian, Skew: ratio(0.99)}, true},
+		{"negative batch size", WorkloadParams{BatchSize: -1}, false},
+		{"negative key range", WorkloadParams{KeyRange: -1}, false},
+		{"negative devices", WorkloadParams{Devices: -1}, false},
+		{"read ratio 0", WorkloadParams{ReadRatio: ratio(0)}, true},
+		{"read ratio 1", WorkloadParams{ReadRatio: ratio(1)}, true},
+		{"read ratio above 1", WorkloadParams{ReadRatio: ratio(1.1)}, false},
+		{"negative read ratio", WorkloadParams{ReadRatio: ratio(-0.1)}, false},
+		{"unknown distribution", WorkloadParams{Distribution: "gaussian"}, false},
+		{"skew below 1", WorkloadParams{Distribution: DistZipfian, Skew: ratio(0.5)}, true},
+		{"skew above 1", WorkloadParams{Distribution: DistZipfian, Skew: ratio(1.5)}, false},
+		{"skew 1", WorkloadParams{Distribution: DistZipfian, Skew: ratio(1)}, false},
+		{"latest skew above 1", WorkloadParams{Distribution: DistLatest, Skew: ratio(1.2)}, false},
+		{"negative skew", WorkloadParams{Distribution: DistZipfian, Skew: ratio(-0.5)}, false},
+		{"hot keys just below 1", WorkloadParams{Distribution: DistHotspot, HotKeys: ratio(0.99)}, true},
+		{"hot keys 1", WorkloadParams{Distribution: DistHotspot, HotKeys: ratio(1)}, false},
+		{"negative hot keys", WorkloadParams{Distribution: DistHotspot, HotKeys: ratio(-0.1)}, false},
+		{"hot ops 1", WorkloadParams{Distribution: DistHotspot, HotOps: ratio(1)}, true},
+		{"hot ops above 1", WorkloadParams{Distribution: DistHotspot, HotOps: ratio(1.1)}, false},
+		{"negative hot ops", WorkloadParams{Distribution: DistHotspot, HotOps: ratio(-0.1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.params.validate(); (err == nil) != tt.ok {
+				t.Errorf("validate() = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestApplySeedKeyRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		workload string
+		params   WorkloadParams
+		seed     SeedOptions
+		ok       bool
+		keyRange int
+		devices  int
+	}{
+		{"seeded rows", "simple_read", WorkloadParams{}, SeedOptions{Rows: 5000, Devices: 10}, true, 5000, 10},
+		{"key range set", "simple_read", WorkloadParams{KeyRange: 100}, SeedOptions{Rows: 0, Devices: 10}, true, 100, 10},
+		{"no seeded rows", "simple_read", WorkloadParams{}, SeedOptions{Rows: 0, Devices: 10}, false, 0, 0},
+		{"writes ignore seeded devices", "timeseries_insert", WorkloadParams{}, SeedOptions{Rows: 0, Devices: 0}, true, 0, 0},
+		{"no seeded devices", "aggregation", WorkloadParams{}, SeedOptions{Rows: 1000, Devices: 0}, false, 0, 0},
+		{"devices set", "aggregation", WorkloadParams{Devices: 5}, SeedOptions{Rows: 1000, Devices: 0}, true, 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scenario{Tests: []ScenarioTest{{Name: tt.name, Workload: tt.workload, Params: tt.params}}}
+			err := s.applySeed(tt.seed)
+			if (err == nil) != tt.ok {
+				t.Fatalf("applySeed() = %v, want ok = %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if p := s.Tests[0].Params; p.KeyRange != tt.keyRange || p.Devices != tt.devices {
+				t.Errorf("key_range, devices = %d, %d, want %d, %d", p.KeyRange, p.Devices, tt.keyRange, tt.devices)
+			}
+		})
+	}
+}
+
+func TestWorkloadParamsExplicitZero(t *testing.T) {
+	defaults := workloads["mixed"].Defaults()
+	tests := []struct {
+		name      string
+		params    string
+		readRatio float64
+	}{
+		{"unset", `{}`, 0.7},
+		{"only writes", `{"read_ratio": 0}`, 0},
+		{"only reads", `{"read_ratio": 1}`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p WorkloadParams
+			if err := json.Unmarshal([]byte(tt.params), &p); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if got := *p.withDefaults(defaults).ReadRatio; got != tt.readRatio {
+				t.Errorf("read_ratio = %g, want %g", got, tt.readRatio)
+			}
+		})
+	}
+}
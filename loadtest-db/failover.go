@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// failoverOpInterval is the pause between iterations of a failover worker
+	failoverOpInterval = 50 * time.Millisecond
+	// failoverRetryDelay is the pause before a failed write is retried
+	failoverRetryDelay = 100 * time.Millisecond
+	// failoverVerifyWait is how long the final write check waits for the database
+	failoverVerifyWait = time.Minute
+	// maxFailoverErrors caps the errors kept in the report; all are counted
+	maxFailoverErrors = 1000
+)
+
+// FailoverOptions configure the failover test
+type FailoverOptions struct {
+	Duration     time.Duration
+	Workers      int
+	OpTimeout    time.Duration
+	Hook         string // disrupts a backend, e.g. "docker stop timescale-replica"
+	HookDelay    time.Duration
+	RecoverHook  string // restores it, e.g. "docker start timescale-replica"
+	RecoverDelay time.Duration
+	MaxDowntime  time.Duration // fail the run if one window of unavailability is longer
+}
+
+// FailoverResult is the outcome of the failover test
+type FailoverResult struct {
+	Target       string        `json:"target"`
+	Duration     time.Duration `json:"duration_ns"`
+	Workers      int           `json:"workers"`
+	Reads        int64         `json:"reads"`
+	FailedReads  int64         `json:"failed_reads"`
+	Writes       int64         `json:"writes"`
+	FailedWrites int64         `json:"failed_writes"`
+
+	ErrorCount int64           `json:"error_count"`
+	Errors     []FailoverError `json:"errors"` // the first maxFailoverErrors
+
+	Windows         []UnavailabilityWindow `json:"unavailability_windows"`
+	TotalDowntime   time.Duration          `json:"total_downtime_ns"`
+	LongestDowntime time.Duration          `json:"longest_downtime_ns"`
+
+	Hooks              []HookEvent   `json:"hooks,omitempty"`
+	TimeToFirstSuccess time.Duration `json:"time_to_first_success_ns,omitempty"` // after the recover hook
+
+	AcknowledgedWrites int64    `json:"acknowledged_writes"`
+	LostWrites         int64    `json:"lost_writes"`
+	DuplicatedWrites   int64    `json:"duplicated_writes"`
+	LostKeys           []string `json:"lost_keys,omitempty"`
+	VerifyError        string   `json:"verify_error,omitempty"`
+}
+
+// FailoverError is a single failed operation
+type FailoverError struct {
+	At    time.Time `json:"at"`
+	Op    string    `json:"op"`
+	Error string    `json:"error"`
+}
+
+// UnavailabilityWindow runs from the first failed operation to the next success
+type UnavailabilityWindow struct {
+	Start      time.Time     `json:"start"`
+	End        time.Time     `json:"end"`
+	Duration   time.Duration `json:"duration_ns"`
+	FailedOps  int64         `json:"failed_ops"`
+	FirstError string        `json:"first_error"`
+}
+
+// HookEvent records a hook command run during the test
+type HookEvent struct {
+	Name    string    `json:"name"`
+	Command string    `json:"command"`
+	At      time.Time `json:"at"`
+	Output  string    `json:"output,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// failoverMonitor turns the stream of operation outcomes into windows of unavailability
+type failoverMonitor struct {
+	mu          sync.Mutex
+	result      *FailoverResult
+	down        bool
+	window      UnavailabilityWindow
+	recoveredAt time.Time
+	acked       map[string]bool
+	live        *testMetrics
+}
+
+func (m *failoverMonitor) observe(op string, start time.Time, err error) {
+	at := time.Now()
+	m.live.finishOp(at.Sub(start), err)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.result
+
+	if op == "write" {
+		r.Writes++
+	} else {
+		r.Reads++
+	}
+
+	if err != nil {
+		if op == "write" {
+			r.FailedWrites++
+		} else {
+			r.FailedReads++
+		}
+		r.ErrorCount++
+		if len(r.Errors) < maxFailoverErrors {
+			r.Errors = append(r.Errors, FailoverError{At: at, Op: op, Error: err.Error()})
+		}
+		if !m.down {
+			m.down = true
+			m.window = UnavailabilityWindow{Start: at, FirstError: err.Error()}
+			fmt.Printf("   %s[DOWN]%s %s %s failed: %v\n", Red, Reset, at.Format("15:04:05.000"), op, err)
+		}
+		m.window.FailedOps++
+		return
+	}
+
+	if m.down {
+		m.down = false
+		m.window.End = at
+		m.window.Duration = at.Sub(m.window.Start)
+		m.closeWindow()
+		fmt.Printf("   %s[UP]%s   %s first success after %v (%d failed ops)\n", Green, Reset,
+			at.Format("15:04:05.000"), m.window.Duration.Round(time.Millisecond), m.window.FailedOps)
+	}
+	if !m.recoveredAt.IsZero() && r.TimeToFirstSuccess == 0 && at.After(m.recoveredAt) {
+		r.TimeToFirstSuccess = at.Sub(m.recoveredAt)
+	}
+}
+
+func (m *failoverMonitor) closeWindow() {
+	r := m.result
+	r.Windows = append(r.Windows, m.window)
+	r.TotalDowntime += m.window.Duration
+	if m.window.Duration > r.LongestDowntime {
+		r.LongestDowntime = m.window.Duration
+	}
+}
+
+func (m *failoverMonitor) ack(key string) {
+	m.mu.Lock()
+	m.acked[key] = true
+	m.mu.Unlock()
+}
+
+func (m *failoverMonitor) hook(event HookEvent, recovery bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.result.Hooks = append(m.result.Hooks, event)
+	if recovery {
+		m.recoveredAt = event.At
+	}
+}
+
+func (m *failoverMonitor) progress() (ops, errors int64, down bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.result.Reads + m.result.Writes, m.result.ErrorCount, m.down
+}
+
+// setupFailoverTable creates the table written during the failover test. It has
+// no unique key, so a write that is retried after an ambiguous failure shows up
+// as a duplicate.
+func setupFailoverTable(db *sql.DB, schema string) error {
+	table := qualify(schema, "loadtest_failover")
+	if _, err := db.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE TABLE ` + table + ` (
+		key TEXT NOT NULL,
+		worker INTEGER NOT NULL,
+		seq BIGINT NOT NULL,
+		written_at TIMESTAMPTZ DEFAULT NOW()
+	)`)
+	return err
+}
+
+// runFailoverTest keeps steady read/write traffic on db until ctx is done or the
+// duration passes, runs the hooks on schedule and finally checks that every
+// acknowledged write survived exactly once
+func runFailoverTest(ctx context.Context, db *sql.DB, target string, opts FailoverOptions, metrics *metricsRegistry) FailoverResult {
+	result := &FailoverResult{Target: target, Workers: opts.Workers, Errors: []FailoverError{}, Windows: []UnavailabilityWindow{}}
+	m := &failoverMonitor{result: result, acked: map[string]bool{}, live: metrics.test("failover")}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.live.addWorkers(1)
+			defer m.live.addWorkers(-1)
+			runFailoverWorker(ctx, db, w, opts.OpTimeout, m)
+		}()
+	}
+
+	if opts.Hook != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !sleepUntil(ctx, start.Add(opts.HookDelay)) {
+				return
+			}
+			m.hook(runHook("disrupt", opts.Hook), false)
+			if opts.RecoverHook == "" || !sleepUntil(ctx, time.Now().Add(opts.RecoverDelay)) {
+				return
+			}
+			m.hook(runHook("recover", opts.RecoverHook), true)
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ops, errors, down := m.progress()
+				state := Green + "UP" + Reset
+				if down {
+					state = Red + "DOWN" + Reset
+				}
+				fmt.Printf("   [%s] %v elapsed | %d ops | %d errors | %s\n", time.Now().Format("15:04:05"),
+					time.Since(start).Round(time.Second), ops, errors, state)
+			}
+		}
+	}()
+
+	wg.Wait()
+	result.Duration = time.Since(start)
+
+	// A window still open at the end lasted until the end of the test
+	m.mu.Lock()
+	if m.down {
+		m.window.End = time.Now()
+		m.window.Duration = m.window.End.Sub(m.window.Start)
+		m.closeWindow()
+	}
+	m.mu.Unlock()
+
+	result.AcknowledgedWrites = int64(len(m.acked))
+	if err := verifyFailoverWrites(db, m.acked, result); err != nil {
+		result.VerifyError = err.Error()
+	}
+	return *result
+}
+
+func runFailoverWorker(ctx context.Context, db *sql.DB, worker int, opTimeout time.Duration, m *failoverMonitor) {
+	for seq := 0; ctx.Err() == nil; seq++ {
+		key := fmt.Sprintf("w%d-%d", worker, seq)
+
+		// Retry the same write until it is acknowledged, as a naive client would;
+		// if a failed attempt did commit, the row is duplicated
+		for ctx.Err() == nil {
+			opStart := time.Now()
+			m.live.startOp()
+			opCtx, cancel := context.WithTimeout(ctx, opTimeout)
+			_, err := db.ExecContext(opCtx, `INSERT INTO loadtest_failover (key, worker, seq) VALUES ($1, $2, $3)`, key, worker, seq)
+			cancel()
+			if ctx.Err() != nil {
+				m.live.abortOp()
+				return
+			}
+			m.observe("write", opStart, err)
+			if err == nil {
+				m.ack(key)
+				break
+			}
+			sleepUntil(ctx, time.Now().Add(failoverRetryDelay))
+		}
+
+		opStart := time.Now()
+		m.live.startOp()
+		opCtx, cancel := context.WithTimeout(ctx, opTimeout)
+		var count int
+		err := db.QueryRowContext(opCtx, `SELECT COUNT(*) FROM loadtest_failover WHERE key = $1`, key).Scan(&count)
+		cancel()
+		if ctx.Err() != nil {
+			m.live.abortOp()
+			return
+		}
+		m.observe("read", opStart, err)
+
+		sleepUntil(ctx, time.Now().Add(failoverOpInterval))
+	}
+}
+
+// runHook runs command with sh -c and records when it ran and what it printed
+func runHook(name, command string) HookEvent {
+	event := HookEvent{Name: name, Command: command, At: time.Now()}
+	fmt.Printf("   %s[HOOK]%s %s %s: %s\n", Yellow, Reset, event.At.Format("15:04:05.000"), name, command)
+
+	out, err := exec.Command("sh", "-c", command).CombinedOutput()
+	event.Output = strings.TrimSpace(string(out))
+	if err != nil {
+		event.Error = err.Error()
+		logWarning(fmt.Sprintf("%s hook failed: %v", name, err))
+	}
+	return event
+}
+
+// verifyFailoverWrites counts acknowledged writes that are missing and rows that
+// were written more than once. It waits for the database to come back first.
+func verifyFailoverWrites(db *sql.DB, acked map[string]bool, result *FailoverResult) error {
+	deadline := time.Now().Add(failoverVerifyWait)
+	var err error
+	for {
+		if err = db.Ping(); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("database did not come back for the write check: %w", err)
+	}
+
+	rows, err := db.Query(`SELECT key, COUNT(*) FROM loadtest_failover GROUP BY key`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool, len(acked))
+	for rows.Next() {
+		var key string
+		var count int64
+		if err := rows.Scan(&key, &count); err != nil {
+			return err
+		}
+		seen[key] = true
+		if count > 1 {
+			result.DuplicatedWrites += count - 1
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(acked) {
+		if !seen[key] {
+			result.LostWrites++
+			if len(result.LostKeys) < maxFailoverErrors {
+				result.LostKeys = append(result.LostKeys, key)
+			}
+		}
+	}
+	return nil
+}
+
+func printFailoverReport(result FailoverResult, opts FailoverOptions) {
+	printSection("Failover Report")
+	fmt.Println()
+
+	fmt.Println("   ┌─────────────────────────────────────────────────────────────────┐")
+	fmt.Printf("   │ %-30s %-33s │\n", "Target:", result.Target)
+	fmt.Printf("   │ %-30s %-33s │\n", "Duration:", result.Duration.Round(time.Second))
+	fmt.Printf("   │ %-30s %-33s │\n", "Reads (failed):", fmt.Sprintf("%d (%d)", result.Reads, result.FailedReads))
+	fmt.Printf("   │ %-30s %-33s │\n", "Writes (failed):", fmt.Sprintf("%d (%d)", result.Writes, result.FailedWrites))
+	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
+	fmt.Printf("   │ %-30s %-33d │\n", "Unavailability Windows:", len(result.Windows))
+	fmt.Printf("   │ %-30s %-33s │\n", "Total Downtime:", result.TotalDowntime.Round(time.Millisecond))
+	fmt.Printf("   │ %-30s %-33s │\n", "Longest Downtime:", result.LongestDowntime.Round(time.Millisecond))
+	if result.TimeToFirstSuccess > 0 {
+		fmt.Printf("   │ %-30s %-33s │\n", "First Success After Recover:", result.TimeToFirstSuccess.Round(time.Millisecond))
+	}
+	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
+	fmt.Printf("   │ %-30s %-33d │\n", "Acknowledged Writes:", result.AcknowledgedWrites)
+	fmt.Printf("   │ %-30s %-33d │\n", "Lost Writes:", result.LostWrites)
+	fmt.Printf("   │ %-30s %-33d │\n", "Duplicated Writes:", result.DuplicatedWrites)
+	fmt.Println("   └─────────────────────────────────────────────────────────────────┘")
+
+	if len(result.Windows) > 0 {
+		fmt.Println()
+		fmt.Println("   ┌──────────────┬──────────────┬────────────┬────────────┬──────────────────────────────────┐")
+		fmt.Printf("   │ %-12s │ %-12s │ %-10s │ %-10s │ %-32s │\n", "Start", "End", "Downtime", "Failed Ops", "First Error")
+		fmt.Println("   ├──────────────┼──────────────┼────────────┼────────────┼──────────────────────────────────┤")
+		for _, w := range result.Windows {
+			firstError := w.FirstError
+			if len(firstError) > 32 {
+				firstError = firstError[:29] + "..."
+			}
+			fmt.Printf("   │ %-12s │ %-12s │ %10s │ %10d │ %-32s │\n", w.Start.Format("15:04:05.000"), w.End.Format("15:04:05.000"),
+				w.Duration.Round(time.Millisecond).String(), w.FailedOps, firstError)
+		}
+		fmt.Println("   └──────────────┴──────────────┴────────────┴────────────┴──────────────────────────────────┘")
+	}
+
+	fmt.Println()
+	if result.VerifyError != "" {
+		fmt.Printf("   %s[WARN]%s Could not check the writes: %s\n", Yellow, Reset, result.VerifyError)
+	}
+	if result.LostWrites > 0 {
+		fmt.Printf("   %s[FAIL]%s %d acknowledged writes were lost (first: %s)\n", Red, Reset, result.LostWrites, result.LostKeys[0])
+	}
+	if result.DuplicatedWrites > 0 {
+		fmt.Printf("   %s[WARN]%s %d writes were applied more than once after a failed attempt\n", Yellow, Reset, result.DuplicatedWrites)
+	}
+	if opts.MaxDowntime > 0 && result.LongestDowntime > opts.MaxDowntime {
+		fmt.Printf("   %s[FAIL]%s Longest downtime %v > %v\n", Red, Reset, result.LongestDowntime.Round(time.Millisecond), opts.MaxDowntime)
+	}
+	if len(result.Windows) == 0 {
+		fmt.Printf("   %s[OK]%s No operation failed\n", Green, Reset)
+	}
+}
+
+// passed reports whether no acknowledged write was lost and no window of
+// unavailability was longer than the limit
+func (r FailoverResult) passed(opts FailoverOptions) bool {
+	if r.VerifyError != "" || r.LostWrites > 0 {
+		return false
+	}
+	return opts.MaxDowntime <= 0 || r.LongestDowntime <= opts.MaxDowntime
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB answers statements with canned rows, for testing code that queries
+// the catalog without a database server
+type fakeDB struct {
+	mu      sync.Mutex
+	answers []fakeAnswer
+	queries []string // every statement run, in order
+}
+
+// fakeAnswer is the result of the statements containing match. Statements
+// without an answer return no rows.
+type fakeAnswer struct {
+	match string
+	rows  [][]driver.Value
+	err   error
+}
+
+func openFakeDB(t *testing.T, answers ...fakeAnswer) (*sql.DB, *fakeDB) {
+	f := &fakeDB{answers: answers}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+// ran reports whether a statement containing s was run
+func (f *fakeDB) ran(s string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, q := range f.queries {
+		if strings.Contains(q, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeDB) answer(query string) ([][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+	for _, a := range f.answers {
+		if strings.Contains(query, a.match) {
+			return a.rows, a.err
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return fakeDriver{f} }
+
+type fakeDriver struct{ f *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d.f}, nil }
+
+type fakeConn struct{ f *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.f, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("fakedb: no transactions") }
+
+type fakeStmt struct {
+	f     *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	_, err := s.f.answer(s.query)
+	return driver.RowsAffected(0), err
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	rows, err := s.f.answer(s.query)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("column%d", i)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"math/bits"
+	"time"
+)
+
+// Histogram is an HDR-style latency histogram with a fixed memory footprint.
+//
+// Values are recorded in microseconds into log-linear buckets: every power of two
+// is split into 128 linear sub-buckets, so any recorded value is reported within
+// 1/128 (~0.8%) of its true value. Values above histMaxValue (~71 minutes) are clamped.
+// A Histogram is not safe for concurrent use; give each worker its own and Merge them.
+type Histogram struct {
+	counts [histBucketCount]int64
+	total  int64
+	sum    int64 // nanoseconds
+	min    int64 // nanoseconds
+	max    int64 // nanoseconds
+}
+
+const (
+	histSubBucketBits = 7
+	histSubBuckets    = 1 << histSubBucketBits
+	histMaxBits       = 32
+	histMaxValue      = int64(1)<<histMaxBits - 1
+	histBucketCount   = (histMaxBits - histSubBucketBits + 1) * histSubBuckets
+)
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+// histIndex maps a value in microseconds to its bucket
+func histIndex(v int64) int {
+	shift := bits.Len64(uint64(v)) - histSubBucketBits - 1
+	if shift < 0 {
+		shift = 0
+	}
+	return shift*histSubBuckets + int(v>>shift)
+}
+
+// histValue returns the midpoint, in microseconds, of the values that map to bucket i
+func histValue(i int) int64 {
+	if i < 2*histSubBuckets {
+		return int64(i)
+	}
+	shift := i/histSubBuckets - 1
+	sub := int64(i - shift*histSubBuckets)
+	return sub<<shift + (int64(1)<<shift)/2
+}
+
+// Record adds one latency sample
+func (h *Histogram) Record(d time.Duration) {
+	ns := int64(d)
+	if ns < 0 {
+		ns = 0
+	}
+	if h.total == 0 || ns < h.min {
+		h.min = ns
+	}
+	if ns > h.max {
+		h.max = ns
+	}
+	h.total++
+	h.sum += ns
+
+	us := ns / int64(time.Microsecond)
+	if us > histMaxValue {
+		us = histMaxValue
+	}
+	h.counts[histIndex(us)]++
+}
+
+// Merge adds all samples from o into h
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.total += o.total
+	h.sum += o.sum
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+}
+
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min)
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / h.total)
+}
+
+// Percentile returns the latency at or below which p percent (0-100) of samples fall
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if p >= 100 {
+		return h.Max()
+	}
+
+	rank := int64(p / 100 * float64(h.total))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := time.Duration(histValue(i)) * time.Microsecond
+			// Bucket midpoints can fall outside the exact observed range
+			if v < h.Min() {
+				v = h.Min()
+			}
+			if v > h.Max() {
+				v = h.Max()
+			}
+			return v
+		}
+	}
+	return h.Max()
+}
+
+// histogramJSON is the wire format of a Histogram: only non-empty buckets are
+// written, as [value_us, count] pairs, where value_us is the bucket midpoint
+type histogramJSON struct {
+	Count   int64      `json:"count"`
+	SumNs   int64      `json:"sum_ns"`
+	MinNs   int64      `json:"min_ns"`
+	MaxNs   int64      `json:"max_ns"`
+	Buckets [][2]int64 `json:"buckets_us"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	out := histogramJSON{Count: h.total, SumNs: h.sum, MinNs: h.min, MaxNs: h.max, Buckets: [][2]int64{}}
+	for i, c := range h.counts {
+		if c > 0 {
+			out.Buckets = append(out.Buckets, [2]int64{histValue(i), c})
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (h *Histogram) UnmarshalJSON(b []byte) error {
+	var in histogramJSON
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	*h = Histogram{total: in.Count, sum: in.SumNs, min: in.MinNs, max: in.MaxNs}
+	for _, bucket := range in.Buckets {
+		v := bucket[0]
+		if v > histMaxValue {
+			v = histMaxValue
+		}
+		h.counts[histIndex(v)] += bucket[1]
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// within reports whether got is within rel (a fraction) of want
+func within(got, want time.Duration, rel float64) bool {
+	diff := float64(got - want)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= rel*float64(want)
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	// 1ms, 2ms, ... 10000ms: the p-th percentile is p*100ms
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	if h.Count() != 10000 {
+		t.Errorf("Count() = %d, want 10000", h.Count())
+	}
+	if h.Min() != time.Millisecond || h.Max() != 10*time.Second {
+		t.Errorf("Min(), Max() = %v, %v, want 1ms, 10s", h.Min(), h.Max())
+	}
+	if want := 5000500 * time.Microsecond; h.Mean() != want {
+		t.Errorf("Mean() = %v, want %v", h.Mean(), want)
+	}
+	for _, p := range []float64{50, 90, 95, 99, 99.9} {
+		want := time.Duration(p * 100 * float64(time.Millisecond))
+		if got := h.Percentile(p); !within(got, want, 1.0/128) {
+			t.Errorf("Percentile(%g) = %v, want %v within 1/128", p, got, want)
+		}
+	}
+	if got := h.Percentile(100); got != h.Max() {
+		t.Errorf("Percentile(100) = %v, want the max %v", got, h.Max())
+	}
+	if got := h.Percentile(0); !within(got, time.Millisecond, 1.0/128) {
+		t.Errorf("Percentile(0) = %v, want the smallest sample 1ms", got)
+	}
+}
+
+func TestHistogramPercentileWithinObservedRange(t *testing.T) {
+	// A bucket midpoint may lie outside the samples; percentiles are clamped to them
+	h := NewHistogram()
+	for i := 0; i < 100; i++ {
+		h.Record(1000 * time.Microsecond)
+	}
+	for _, p := range []float64{1, 50, 99.9} {
+		if got := h.Percentile(p); got != 1000*time.Microsecond {
+			t.Errorf("Percentile(%g) = %v, want 1ms", p, got)
+		}
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	h := NewHistogram()
+	if h.Percentile(50) != 0 || h.Mean() != 0 || h.Count() != 0 {
+		t.Errorf("empty histogram: Percentile(50) = %v, Mean() = %v, Count() = %d, want zeros", h.Percentile(50), h.Mean(), h.Count())
+	}
+}
+
+func TestHistogramClamping(t *testing.T) {
+	h := NewHistogram()
+	h.Record(-time.Second)
+	for i := 0; i < 3; i++ {
+		h.Record(2 * time.Hour)
+	}
+
+	if h.Min() != 0 {
+		t.Errorf("Min() = %v, want negative samples recorded as 0", h.Min())
+	}
+	if h.Max() != 2*time.Hour {
+		t.Errorf("Max() = %v, want the exact 2h", h.Max())
+	}
+	if got := h.Percentile(25); got != 0 {
+		t.Errorf("Percentile(25) = %v, want 0", got)
+	}
+	// Beyond histMaxValue the sample lands in the last bucket
+	if want := time.Duration(histMaxValue) * time.Microsecond; !within(h.Percentile(50), want, 1.0/128) {
+		t.Errorf("Percentile(50) = %v, want about %v", h.Percentile(50), want)
+	}
+	if got := histIndex(histMaxValue); got >= histBucketCount {
+		t.Errorf("histIndex(histMaxValue) = %d, out of %d buckets", got, histBucketCount)
+	}
+}
+
+func TestHistogramBucketPrecision(t *testing.T) {
+	for v := int64(0); v <= histMaxValue; v = v*2 + 1 {
+		for _, u := range []int64{v, v + v/3, v + v/2} {
+			if u > histMaxValue {
+				continue
+			}
+			i := histIndex(u)
+			if i < 0 || i >= histBucketCount {
+				t.Fatalf("histIndex(%d) = %d, out of %d buckets", u, i, histBucketCount)
+			}
+			got := histValue(i)
+			diff := got - u
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff*histSubBuckets > u {
+				t.Errorf("histValue(histIndex(%d)) = %d, more than 1/%d off", u, got, histSubBuckets)
+			}
+		}
+	}
+}
+
+func TestHistogramMergeAndJSON(t *testing.T) {
+	a, b := NewHistogram(), NewHistogram()
+	for i := 1; i <= 100; i++ {
+		a.Record(time.Duration(i) * time.Millisecond)
+		b.Record(time.Duration(i+100) * time.Millisecond)
+	}
+	a.Merge(b)
+	a.Merge(nil)
+	if a.Count() != 200 || a.Min() != time.Millisecond || a.Max() != 200*time.Millisecond {
+		t.Errorf("merged Count(), Min(), Max() = %d, %v, %v, want 200, 1ms, 200ms", a.Count(), a.Min(), a.Max())
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var c Histogram
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	for _, p := range []float64{50, 90, 99} {
+		if c.Percentile(p) != a.Percentile(p) {
+			t.Errorf("Percentile(%g) after a JSON round trip = %v, want %v", p, c.Percentile(p), a.Percentile(p))
+		}
+	}
+}
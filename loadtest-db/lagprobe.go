@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lagProber writes a row to PRIMARY at a fixed interval while the load tests run
+// and measures how long it takes to become visible on every replica. Samples are
+// attributed to the test that was running when the row was written.
+type lagProber struct {
+	primary  *sql.DB
+	replicas []replicaConn
+	interval time.Duration
+	maxWait  time.Duration
+	metrics  *metricsRegistry
+	rand     *rand.Rand // used by the probing goroutine only
+	stopped  chan struct{}
+	done     chan struct{}
+
+	mu      sync.Mutex
+	active  bool
+	lags    []time.Duration
+	failed  int
+	pending sync.WaitGroup // attributed samples still waiting on a replica
+}
+
+// startLagProbe starts probing in the background until stop is called
+func startLagProbe(primary *sql.DB, replicas []replicaConn, interval time.Duration, maxWaitSeconds int, metrics *metricsRegistry) *lagProber {
+	p := &lagProber{
+		primary:  primary,
+		replicas: replicas,
+		interval: interval,
+		maxWait:  time.Duration(maxWaitSeconds) * time.Second,
+		metrics:  metrics,
+		rand:     derivedRand("lag_probe"),
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *lagProber) stop() {
+	close(p.stopped)
+	<-p.done
+}
+
+func (p *lagProber) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		select {
+		case <-p.stopped:
+			return
+		case <-ticker.C:
+		}
+
+		// Samples taken between tests are still written, so the probe load stays
+		// constant, but they are not attributed to anything
+		p.mu.Lock()
+		attributed := p.active
+		if attributed {
+			p.pending.Add(1)
+		}
+		p.mu.Unlock()
+
+		lag, ok := p.probe(i)
+
+		if attributed {
+			p.mu.Lock()
+			if ok {
+				p.lags = append(p.lags, lag)
+			} else {
+				p.failed++
+			}
+			p.mu.Unlock()
+			p.pending.Done()
+		}
+	}
+}
+
+// probe writes one row and returns the time until it is visible on the slowest replica
+func (p *lagProber) probe(i int) (time.Duration, bool) {
+	id := fmt.Sprintf("probe-%d-%d-%d", time.Now().UnixNano(), p.rand.Int63(), i)
+	writeTime := time.Now()
+	_, err := p.primary.Exec(`INSERT INTO loadtest_replication (id, write_time, data) VALUES ($1, $2, $3)`,
+		id, writeTime, "lag_probe")
+	if err != nil {
+		return 0, false
+	}
+
+	lags := make([]time.Duration, len(p.replicas))
+	found := make([]bool, len(p.replicas))
+	var wg sync.WaitGroup
+	for r, replica := range p.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lags[r], found[r] = pollReplica(replica.DB, id, writeTime, p.maxWait)
+		}()
+	}
+	wg.Wait()
+
+	var slowest time.Duration
+	for r, replica := range p.replicas {
+		if !found[r] {
+			return 0, false
+		}
+		p.metrics.observeReplicationLag(replica.Name, lags[r])
+		if lags[r] > slowest {
+			slowest = lags[r]
+		}
+	}
+	return slowest, true
+}
+
+// begin attributes the following samples to a new test
+func (p *lagProber) begin() {
+	p.mu.Lock()
+	p.active = true
+	p.lags = nil
+	p.failed = 0
+	p.mu.Unlock()
+}
+
+// end waits for samples written during the test and returns their statistics
+func (p *lagProber) end() *LagStats {
+	p.mu.Lock()
+	p.active = false
+	p.mu.Unlock()
+	p.pending.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := newLagStats(len(p.lags)+p.failed, p.failed, p.lags)
+	return &stats
+}
+
+func printLagUnderLoadReport(results []TestResult) {
+	printSection("Replication Lag Under Load")
+	fmt.Println()
+
+	fmt.Println("   ┌──────────────────────────────────────────┬─────────┬───────────┬───────────┬───────────┬───────────┐")
+	fmt.Printf("   │ %-40s │ %-7s │ %-9s │ %-9s │ %-9s │ %-9s │\n", "Test Name", "Samples", "Avg Lag", "P95 Lag", "P99 Lag", "Max Lag")
+	fmt.Println("   ├──────────────────────────────────────────┼─────────┼───────────┼───────────┼───────────┼───────────┤")
+
+	for _, r := range results {
+		if r.ReplicationLag == nil {
+			continue
+		}
+		name := r.Name
+		if len(name) > 38 {
+			name = name[:35] + "..."
+		}
+		lag := r.ReplicationLag
+		fmt.Printf("   │ %-40s │ %7d │ %9s │ %9s │ %9s │ %9s │\n", name, lag.TestCount,
+			lag.AvgLag.Round(time.Microsecond).String(), lag.P95Lag.Round(time.Microsecond).String(),
+			lag.P99Lag.Round(time.Microsecond).String(), lag.MaxLag.Round(time.Microsecond).String())
+	}
+
+	fmt.Println("   └──────────────────────────────────────────┴─────────┴───────────┴───────────┴───────────┴───────────┘")
+
+	for _, r := range results {
+		if r.ReplicationLag != nil && r.ReplicationLag.FailedCount > 0 {
+			fmt.Printf("   %s[WARN]%s %s: %d of %d lag samples failed or timed out\n", Yellow, Reset,
+				r.Name, r.ReplicationLag.FailedCount, r.ReplicationLag.TestCount)
+		}
+	}
+}
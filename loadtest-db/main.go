@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"math/rand"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -47,29 +49,39 @@ func initColors() {
 
 // TestResult holds the result of a single test
 type TestResult struct {
-	Name         string
-	Duration     time.Duration
-	TotalOps     int64
-	SuccessOps   int64
-	FailedOps    int64
-	AvgLatency   time.Duration
-	MinLatency   time.Duration
-	MaxLatency   time.Duration
-	OpsPerSecond float64
-}
-
-// ReplicationResult holds replication lag test results
-type ReplicationResult struct {
-	TestCount    int
-	SuccessCount int
-	FailedCount  int
-	AvgLag       time.Duration
-	MinLag       time.Duration
-	MaxLag       time.Duration
-	P50Lag       time.Duration
-	P95Lag       time.Duration
-	P99Lag       time.Duration
-	AllLags      []time.Duration
+	Name         string        `json:"name"`
+	Duration     time.Duration `json:"duration_ns"`
+	TotalOps     int64         `json:"total_ops"`
+	SuccessOps   int64         `json:"success_ops"`
+	FailedOps    int64         `json:"failed_ops"`
+	AvgLatency   time.Duration `json:"avg_latency_ns"`
+	MinLatency   time.Duration `json:"min_latency_ns"`
+	MaxLatency   time.Duration `json:"max_latency_ns"`
+	P50Latency   time.Duration `json:"p50_latency_ns"`
+	P90Latency   time.Duration `json:"p90_latency_ns"`
+	P95Latency   time.Duration `json:"p95_latency_ns"`
+	P99Latency   time.Duration `json:"p99_latency_ns"`
+	P999Latency  time.Duration `json:"p999_latency_ns"`
+	OpsPerSecond float64       `json:"ops_per_second"`
+	Latency      *Histogram    `json:"latency_histogram,omitempty"`
+
+	// Open-loop mode only: the requested rate and the scheduled operations that
+	// were never issued because every worker was still busy
+	TargetRate float64 `json:"target_rate,omitempty"`
+	MissedOps  int64   `json:"missed_ops,omitempty"`
+
+	// Replication lag sampled in the background while the test ran (all phases)
+	ReplicationLag *LagStats `json:"replication_lag,omitempty"`
+
+	// Proxy tests only: which backend served the reads (all phases)
+	ReadSplit *ReadSplit `json:"read_split,omitempty"`
+
+	// read_your_writes workload only: stale reads per check (all phases)
+	ReadYourWrites *ReadYourWritesResult `json:"read_your_writes,omitempty"`
+
+	// SLO thresholds the test was checked against, and the ones it missed
+	Assertions *Assertions `json:"assertions,omitempty"`
+	Violations []string    `json:"slo_violations,omitempty"`
 }
 
 // Config holds database configuration
@@ -81,15 +93,72 @@ type Config struct {
 	PrimaryPassword string
 	PrimaryDB       string
 
-	// Replica DB (optional)
+	// Replica DBs (optional). REPLICA_HOSTS takes precedence over REPLICA_HOST and
+	// REPLICA_HOST_2; user, password and database are shared by all replicas.
+	ReplicaHosts    string
 	ReplicaHost     string
+	ReplicaHost2    string
 	ReplicaPort     string
 	ReplicaUser     string
 	ReplicaPassword string
 	ReplicaDB       string
 
+	// Proxy (optional)
+	ProxyHost     string
+	ProxyPort     string
+	ProxyUser     string
+	ProxyPassword string
+	ProxyDB       string
+
 	// Test options
 	EnableReplicationTest bool
+	ScenarioFile          string
+	ReplicationTestCount  int
+	ReplicationMaxWait    int
+	LagProbeInterval      time.Duration
+	ReadWeightPrimary     float64
+	ReadWeightReplica     float64
+	LoadBalanceOnWrite    string
+	ResultsFile           string
+	BaselineFile          string
+	RegressionTolerance   float64
+	FailOnRegression      bool
+	MaxReplicationP99     time.Duration
+	MetricsAddr           string
+
+	// Schema holds the tables of a run; a new loadtest_* schema per run if empty
+	Schema        string
+	JanitorMaxAge time.Duration
+	JanitorDryRun bool
+
+	// Seed data of the test tables
+	SeedRows           int
+	SeedTimeseriesRows int
+	SeedDevices        int
+	SeedSpan           time.Duration
+	SeedChunkInterval  time.Duration
+	SeedWorkers        int
+
+	// Safety: opt-in to creating and dropping objects, or read-only runs
+	AllowDestructive bool
+	ReadOnly         bool
+
+	// KeepData leaves the seeded tables in place for the next run
+	KeepData bool
+
+	// RandomSeed repeats the random choices of an earlier run; a new seed if 0
+	RandomSeed int64
+
+	// Failover test
+	FailoverTarget       string
+	FailoverDuration     time.Duration
+	FailoverWorkers      int
+	FailoverOpTimeout    time.Duration
+	FailoverHook         string
+	FailoverHookDelay    time.Duration
+	FailoverRecoverHook  string
+	FailoverRecoverDelay time.Duration
+	FailoverMaxDowntime  time.Duration
 }
 
 func main() {
@@ -98,132 +167,45 @@ func main() {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(0)
 
-	printBanner()
-
-	cfg := loadConfig()
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	// Connect to Primary
-	primaryConnStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.PrimaryHost, cfg.PrimaryPort, cfg.PrimaryUser, cfg.PrimaryPassword, cfg.PrimaryDB)
+// openDatabase connects to a database node, verifies it is reachable and prints its
+// details. schema, if set, goes first on the search_path of every connection.
+func openDatabase(role, host, port, user, password, dbname, schema string) (*sql.DB, DatabaseInfo, error) {
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbname) + searchPathParam(schema) + readOnlySessionParam()
 
-	printSection("Database Connection - PRIMARY")
-	logInfo("Host", fmt.Sprintf("%s:%s", cfg.PrimaryHost, cfg.PrimaryPort))
-	logInfo("User", cfg.PrimaryUser)
-	logInfo("Database", cfg.PrimaryDB)
+	printSection("Database Connection - " + role)
+	logInfo("Host", fmt.Sprintf("%s:%s", host, port))
+	logInfo("User", user)
+	logInfo("Database", dbname)
+	if schema != "" {
+		logInfo("Schema", schema)
+	}
 
-	primaryDB, err := sql.Open("postgres", primaryConnStr)
+	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		logError("Failed to open primary database", err)
-		os.Exit(1)
+		logError("Failed to open "+strings.ToLower(role)+" database", err)
+		return nil, DatabaseInfo{}, err
 	}
-	defer primaryDB.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := primaryDB.PingContext(ctx); err != nil {
-		logError("Failed to connect to primary database", err)
-		os.Exit(1)
+	if err := db.PingContext(ctx); err != nil {
+		logError("Failed to connect to "+strings.ToLower(role)+" database", err)
+		db.Close()
+		return nil, DatabaseInfo{}, err
 	}
-	logSuccess("Connected to PRIMARY database successfully!")
-	printDatabaseInfo(primaryDB)
-
-	// Connect to Replica (if configured)
-	var replicaDB *sql.DB
-	if cfg.EnableReplicationTest && cfg.ReplicaHost != "" {
-		replicaConnStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-			cfg.ReplicaHost, cfg.ReplicaPort, cfg.ReplicaUser, cfg.ReplicaPassword, cfg.ReplicaDB)
-
-		printSection("Database Connection - REPLICA")
-		logInfo("Host", fmt.Sprintf("%s:%s", cfg.ReplicaHost, cfg.ReplicaPort))
-		logInfo("User", cfg.ReplicaUser)
-		logInfo("Database", cfg.ReplicaDB)
-
-		replicaDB, err = sql.Open("postgres", replicaConnStr)
-		if err != nil {
-			logError("Failed to open replica database", err)
-			os.Exit(1)
-		}
-		defer replicaDB.Close()
-
-		ctx2, cancel2 := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel2()
-
-		if err := replicaDB.PingContext(ctx2); err != nil {
-			logError("Failed to connect to replica database", err)
-			os.Exit(1)
-		}
-		logSuccess("Connected to REPLICA database successfully!")
-		printDatabaseInfo(replicaDB)
-	}
-
-	// Setup test tables
-	printSection("Setting Up Test Environment")
-	if err := setupTestTables(primaryDB); err != nil {
-		logError("Failed to setup test tables", err)
-		os.Exit(1)
-	}
-	logSuccess("Test tables created successfully!")
-
-	// Run all load tests
-	results := []TestResult{}
-
-	printSection("Running Load Tests")
-	fmt.Println()
-
-	// Test 1: Light Load - Simple Reads
-	results = append(results, runTest(primaryDB, "Light Load - Simple Reads", 5, 10, 5*time.Second, testSimpleRead))
-
-	// Test 2: Light Load - Simple Writes
-	results = append(results, runTest(primaryDB, "Light Load - Simple Writes", 5, 10, 5*time.Second, testSimpleWrite))
-
-	// Test 3: Medium Load - Mixed Operations
-	results = append(results, runTest(primaryDB, "Medium Load - Mixed R/W", 10, 50, 10*time.Second, testMixedOperations))
-
-	// Test 4: Medium Load - Batch Inserts
-	results = append(results, runTest(primaryDB, "Medium Load - Batch Inserts", 10, 20, 10*time.Second, testBatchInsert))
-
-	// Test 5: Heavy Load - Concurrent Reads
-	results = append(results, runTest(primaryDB, "Heavy Load - Concurrent Reads", 20, 100, 15*time.Second, testSimpleRead))
-
-	// Test 6: Heavy Load - Concurrent Writes
-	results = append(results, runTest(primaryDB, "Heavy Load - Concurrent Writes", 20, 100, 15*time.Second, testSimpleWrite))
-
-	// Test 7: Stress Test - Maximum Throughput
-	results = append(results, runTest(primaryDB, "Stress Test - Max Throughput", 50, 200, 20*time.Second, testMixedOperations))
-
-	// Test 8: TimescaleDB Specific - Time Series Insert
-	results = append(results, runTest(primaryDB, "TimescaleDB - Time Series Insert", 10, 50, 10*time.Second, testTimeSeriesInsert))
+	logSuccess("Connected to " + role + " database successfully!")
+	info := printDatabaseInfo(db)
+	info.Role = role
+	info.Host = host
+	info.Port = port
+	info.Database = dbname
 
-	// Test 9: TimescaleDB Specific - Time Range Query
-	results = append(results, runTest(primaryDB, "TimescaleDB - Time Range Query", 10, 50, 10*time.Second, testTimeRangeQuery))
-
-	// Test 10: Complex Query Test
-	results = append(results, runTest(primaryDB, "Complex - Aggregation Queries", 5, 20, 10*time.Second, testComplexQuery))
-
-	// Print load test report
-	printFinalReport(results)
-
-	// Run Replication Lag Test (if replica is configured)
-	if replicaDB != nil && cfg.EnableReplicationTest {
-		printSection("Replication Lag Test")
-		fmt.Println()
-		logInfo("Test Description", "Write to PRIMARY, measure time until data appears on REPLICA")
-		fmt.Println()
-
-		repResult := runReplicationLagTest(primaryDB, replicaDB, 100, 10) // 100 tests, max 10s wait
-		printReplicationReport(repResult)
-	}
-
-	// Cleanup
-	printSection("Cleanup")
-	if err := cleanupTestTables(primaryDB); err != nil {
-		logWarning("Failed to cleanup test tables: " + err.Error())
-	} else {
-		logSuccess("Test tables cleaned up successfully!")
-	}
-
-	printFooter()
+	return db, info, nil
 }
 
 func loadConfig() Config {
@@ -236,13 +218,63 @@ func loadConfig() Config {
 		PrimaryDB:       getEnv("DB_NAME", getEnv("PRIMARY_DB", "postgres")),
 
 		// Replica DB
+		ReplicaHosts:    getEnv("REPLICA_HOSTS", ""),
 		ReplicaHost:     getEnv("REPLICA_HOST", ""),
+		ReplicaHost2:    getEnv("REPLICA_HOST_2", ""),
 		ReplicaPort:     getEnv("REPLICA_PORT", "5432"),
 		ReplicaUser:     getEnv("REPLICA_USER", getEnv("DB_USER", "postgres")),
 		ReplicaPassword: getEnv("REPLICA_PASSWORD", getEnv("DB_PASSWORD", "")),
 		ReplicaDB:       getEnv("REPLICA_DB", getEnv("DB_NAME", "postgres")),
 
+		// Proxy
+		ProxyHost:     getEnv("PROXY_HOST", ""),
+		ProxyPort:     getEnv("PROXY_PORT", "5432"),
+		ProxyUser:     getEnv("PROXY_USER", getEnv("DB_USER", "postgres")),
+		ProxyPassword: getEnv("PROXY_PASSWORD", getEnv("DB_PASSWORD", "")),
+		ProxyDB:       getEnv("PROXY_DB", getEnv("DB_NAME", "postgres")),
+
 		EnableReplicationTest: getEnv("ENABLE_REPLICATION_TEST", "") != "",
+		ScenarioFile:          getEnv("SCENARIO_FILE", ""),
+		ReplicationTestCount:  getEnvInt("REPLICATION_TEST_COUNT", 100),
+		ReplicationMaxWait:    getEnvInt("REPLICATION_MAX_WAIT", 10),
+		LagProbeInterval:      getEnvDuration("REPLICATION_PROBE_INTERVAL", time.Second),
+		ReadWeightPrimary:     getEnvFloat("READ_WEIGHT_PRIMARY", 0),
+		ReadWeightReplica:     getEnvFloat("READ_WEIGHT_REPLICA", 1),
+		LoadBalanceOnWrite:    getEnv("LOAD_BALANCE_ON_WRITE", ""),
+		ResultsFile:           getEnv("RESULTS_FILE", ""),
+		BaselineFile:          getEnv("BASELINE_FILE", ""),
+		RegressionTolerance:   getEnvFloat("REGRESSION_TOLERANCE", 10),
+		FailOnRegression:      getEnv("FAIL_ON_REGRESSION", "") != "",
+		MaxReplicationP99:     getEnvDuration("MAX_REPLICATION_P99", 0),
+		MetricsAddr:           getEnv("METRICS_ADDR", ""),
+
+		Schema:        getEnv("LOADTEST_SCHEMA", ""),
+		JanitorMaxAge: getEnvDuration("JANITOR_MAX_AGE", 10*time.Minute),
+		JanitorDryRun: getEnv("JANITOR_DRY_RUN", "") != "",
+
+		SeedRows:           getEnvInt("SEED_ROWS", 1000),
+		SeedTimeseriesRows: getEnvInt("SEED_TIMESERIES_ROWS", 1000),
+		SeedDevices:        getEnvInt("SEED_DEVICES", 10),
+		SeedSpan:           getEnvDuration("SEED_SPAN", 24*time.Hour),
+		SeedChunkInterval:  getEnvDuration("SEED_CHUNK_INTERVAL", 0),
+		SeedWorkers:        getEnvInt("SEED_WORKERS", 4),
+
+		AllowDestructive: getEnv("ALLOW_DESTRUCTIVE", "") != "",
+		ReadOnly:         getEnv("READ_ONLY", "") != "",
+
+		KeepData: getEnv("KEEP_DATA", "") != "",
+
+		RandomSeed: int64(getEnvInt("RANDOM_SEED", 0)),
+
+		FailoverTarget:       getEnv("FAILOVER_TARGET", ""),
+		FailoverDuration:     getEnvDuration("FAILOVER_DURATION", 5*time.Minute),
+		FailoverWorkers:      getEnvInt("FAILOVER_WORKERS", 4),
+		FailoverOpTimeout:    getEnvDuration("FAILOVER_OP_TIMEOUT", 5*time.Second),
+		FailoverHook:         getEnv("FAILOVER_HOOK", ""),
+		FailoverHookDelay:    getEnvDuration("FAILOVER_HOOK_DELAY", 30*time.Second),
+		FailoverRecoverHook:  getEnv("FAILOVER_RECOVER_HOOK", ""),
+		FailoverRecoverDelay: getEnvDuration("FAILOVER_RECOVER_DELAY", 30*time.Second),
+		FailoverMaxDowntime:  getEnvDuration("FAILOVER_MAX_DOWNTIME", 0),
 	}
 
 	return cfg
@@ -255,32 +287,68 @@ func getEnv(key, defaultVal string) string {
 	return defaultVal
 }
 
-func setupTestTables(db *sql.DB) error {
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+		logWarning(fmt.Sprintf("Ignoring invalid %s=%q, using %g", key, val, defaultVal))
+	}
+	return defaultVal
+}
+
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+		logWarning(fmt.Sprintf("Ignoring invalid %s=%q, using %v", key, val, defaultVal))
+	}
+	return defaultVal
+}
+
+func getEnvInt(key string, defaultVal int) int {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+		logWarning(fmt.Sprintf("Ignoring invalid %s=%q, using %d", key, val, defaultVal))
+	}
+	return defaultVal
+}
+
+// setupTestTables creates and seeds the test tables in schema, which startRun
+// has created. Only tables of that schema are dropped.
+func setupTestTables(db *sql.DB, schema string, seed SeedOptions) error {
+	simple, timeseries, replication := qualify(schema, "loadtest_simple"), qualify(schema, "loadtest_timeseries"), qualify(schema, "loadtest_replication")
 	queries := []string{
-		`DROP TABLE IF EXISTS loadtest_simple CASCADE`,
-		`DROP TABLE IF EXISTS loadtest_timeseries CASCADE`,
-		`DROP TABLE IF EXISTS loadtest_replication CASCADE`,
-		`CREATE TABLE loadtest_simple (
+		`DROP TABLE IF EXISTS ` + simple + ` CASCADE`,
+		`DROP TABLE IF EXISTS ` + timeseries + ` CASCADE`,
+		`DROP TABLE IF EXISTS ` + replication + ` CASCADE`,
+		`CREATE TABLE ` + simple + ` (
 			id SERIAL PRIMARY KEY,
 			data TEXT,
 			value INTEGER,
 			created_at TIMESTAMPTZ DEFAULT NOW()
 		)`,
-		`CREATE TABLE loadtest_timeseries (
+		`CREATE TABLE ` + timeseries + ` (
 			time TIMESTAMPTZ NOT NULL,
 			device_id TEXT NOT NULL,
 			temperature DOUBLE PRECISION,
 			humidity DOUBLE PRECISION,
 			pressure DOUBLE PRECISION
 		)`,
-		`CREATE TABLE loadtest_replication (
+		`CREATE TABLE ` + replication + ` (
 			id TEXT PRIMARY KEY,
 			write_time TIMESTAMPTZ NOT NULL,
 			data TEXT
 		)`,
-		`CREATE INDEX IF NOT EXISTS idx_loadtest_simple_created ON loadtest_simple(created_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_loadtest_timeseries_time ON loadtest_timeseries(time DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_loadtest_timeseries_device ON loadtest_timeseries(device_id, time DESC)`,
+	}
+	// Indexes are built after seeding, which is faster than maintaining them during COPY
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_loadtest_simple_created ON ` + simple + `(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_loadtest_timeseries_time ON ` + timeseries + `(time DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_loadtest_timeseries_device ON ` + timeseries + `(device_id, time DESC)`,
 	}
 
 	for _, q := range queries {
@@ -290,82 +358,219 @@ func setupTestTables(db *sql.DB) error {
 	}
 
 	// Try to create hypertable (may fail if TimescaleDB is not installed)
-	_, err := db.Exec(`SELECT create_hypertable('loadtest_timeseries', 'time', if_not_exists => TRUE)`)
+	var err error
+	if seed.ChunkInterval > 0 {
+		_, err = db.Exec(`SELECT create_hypertable($1::regclass, 'time', chunk_time_interval => $2::interval, if_not_exists => TRUE)`,
+			timeseries, fmt.Sprintf("%d microseconds", seed.ChunkInterval.Microseconds()))
+	} else {
+		_, err = db.Exec(`SELECT create_hypertable($1::regclass, 'time', if_not_exists => TRUE)`, timeseries)
+	}
 	if err != nil {
 		logWarning("TimescaleDB hypertable creation skipped (extension may not be installed)")
 	} else {
 		logSuccess("TimescaleDB hypertable created!")
 	}
 
-	// Pre-populate with some data
-	for i := 0; i < 1000; i++ {
-		_, err := db.Exec(`INSERT INTO loadtest_simple (data, value) VALUES ($1, $2)`,
-			fmt.Sprintf("initial_data_%d", i), rand.Intn(10000))
-		if err != nil {
-			return err
-		}
+	logInfo("Seed", fmt.Sprintf("%d simple rows, %d timeseries rows over %v from %d devices, %d COPY workers",
+		seed.Rows, seed.TimeseriesRows, seed.Span, seed.Devices, seed.Workers))
+	end := time.Now()
+	if err := seedTables(db, schema, seed, end); err != nil {
+		return err
 	}
 
-	// Pre-populate timeseries
-	baseTime := time.Now().Add(-24 * time.Hour)
-	for i := 0; i < 1000; i++ {
-		t := baseTime.Add(time.Duration(i) * time.Minute)
-		_, err := db.Exec(`INSERT INTO loadtest_timeseries (time, device_id, temperature, humidity, pressure) 
-			VALUES ($1, $2, $3, $4, $5)`,
-			t,
-			fmt.Sprintf("device_%d", rand.Intn(10)),
-			20+rand.Float64()*15,
-			30+rand.Float64()*50,
-			1000+rand.Float64()*50)
-		if err != nil {
-			return err
+	for _, q := range indexes {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("failed to execute: %s - %w", q, err)
 		}
 	}
+	// Fresh statistics, so the first test is not planned against an empty table
+	if _, err := db.Exec(`ANALYZE ` + simple + `, ` + timeseries); err != nil {
+		return fmt.Errorf("failed to analyze test tables: %w", err)
+	}
+	if err := recordDataset(db, schema, seed, end); err != nil {
+		return fmt.Errorf("failed to record dataset: %w", err)
+	}
 
 	return nil
 }
 
-func cleanupTestTables(db *sql.DB) error {
-	queries := []string{
-		`DROP TABLE IF EXISTS loadtest_simple CASCADE`,
-		`DROP TABLE IF EXISTS loadtest_timeseries CASCADE`,
-		`DROP TABLE IF EXISTS loadtest_replication CASCADE`,
+// Test phases
+const (
+	PhaseRampUp   = "ramp-up"
+	PhaseSteady   = "steady"
+	PhaseRampDown = "ramp-down"
+)
+
+// testPhases is the timeline of a test: workers (or the arrival rate) are ramped
+// up, held for the steady-state window and ramped down again. Only operations
+// started inside the steady-state window count towards the reported statistics.
+type testPhases struct {
+	start       time.Time
+	steadyStart time.Time
+	steadyEnd   time.Time
+	end         time.Time
+}
+
+func newTestPhases(start time.Time, rampUp, steady, rampDown time.Duration) testPhases {
+	return testPhases{
+		start:       start,
+		steadyStart: start.Add(rampUp),
+		steadyEnd:   start.Add(rampUp + steady),
+		end:         start.Add(rampUp + steady + rampDown),
 	}
+}
 
-	for _, q := range queries {
-		if _, err := db.Exec(q); err != nil {
-			return err
-		}
+func (p testPhases) at(t time.Time) string {
+	switch {
+	case t.Before(p.steadyStart):
+		return PhaseRampUp
+	case t.Before(p.steadyEnd):
+		return PhaseSteady
+	default:
+		return PhaseRampDown
 	}
-	return nil
 }
 
-type TestFunc func(db *sql.DB) error
+// workerStats is the steady-state tally of a single worker
+type workerStats struct {
+	latency *Histogram
+	total   int64
+	success int64
+	failed  int64
+}
+
+// testEnv is what runTest needs from the run around it: the live metrics and lag
+// probe, both nil when disabled, and the proxy settings the read split and
+// read-your-writes checks are judged against
+type testEnv struct {
+	metrics         *metricsRegistry
+	lagProbe        *lagProber
+	proxyWeights    readWeights
+	loadBalanceMode string
+}
+
+func runTest(db *sql.DB, test ScenarioTest, workload Workload, env testEnv) TestResult {
+	name, concurrency, opsPerWorker := test.Name, test.Concurrency, test.OpsPerWorker
+	rampUp, rampDown := time.Duration(test.RampUp), time.Duration(test.RampDown)
+	params := test.Params.withDefaults(workload.Defaults())
 
-func runTest(db *sql.DB, name string, concurrency, opsPerWorker int, duration time.Duration, testFn TestFunc) TestResult {
 	printTestHeader(name)
-	fmt.Printf("   Concurrency: %d workers | Ops/Worker: %d | Duration: %v\n", concurrency, opsPerWorker, duration)
+	if test.Rate > 0 {
+		fmt.Printf("   Concurrency: %d workers | Target Rate: %.1f ops/s (open loop) | Duration: %v\n", concurrency, test.Rate, time.Duration(test.Duration))
+	} else {
+		fmt.Printf("   Concurrency: %d workers | Ops/Worker: %d | Duration: %v\n", concurrency, opsPerWorker, time.Duration(test.Duration))
+	}
+	if rampUp > 0 || rampDown > 0 {
+		fmt.Printf("   Ramp-up: %v | Steady State: %v | Ramp-down: %v\n", rampUp, time.Duration(test.Duration), rampDown)
+	}
+	if params.Distribution != "" && params.Distribution != DistUniform {
+		fmt.Printf("   Key Distribution: %s\n", describeDistribution(params))
+	}
 	fmt.Println()
 
-	var totalOps, successOps, failedOps int64
-	var totalLatency int64
-	var minLatency, maxLatency int64
-	minLatency = int64(time.Hour)
+	if err := workload.Setup(db, params); err != nil {
+		logError("Workload setup failed", err)
+		return TestResult{Name: name, Latency: NewHistogram()}
+	}
+	defer func() {
+		if err := workload.Teardown(db, params); err != nil {
+			logWarning("Workload teardown failed: " + err.Error())
+		}
+	}()
+
+	// Progress counters cover every phase; the reported statistics come from workerStats
+	var progressSuccess, progressFailed int64
 
-	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	startTime := time.Now()
+	phases := newTestPhases(startTime, rampUp, time.Duration(test.Duration), rampDown)
+
+	ctx, cancel := context.WithDeadline(context.Background(), phases.end)
 	defer cancel()
 
 	var wg sync.WaitGroup
-	startTime := time.Now()
 
 	// Progress display
 	progressDone := make(chan bool)
-	go showProgress(ctx, &successOps, &failedOps, startTime, progressDone)
+	go showProgress(ctx, &progressSuccess, &progressFailed, phases, progressDone)
 
+	// In open-loop mode operations are issued on a fixed schedule, independent of
+	// how fast the database answers
+	var schedule <-chan time.Time
+	if test.Rate > 0 {
+		schedule = scheduleArrivals(ctx, phases, test.Rate, concurrency*opsPerWorker)
+	}
+
+	live := env.metrics.test(name)
+	if env.lagProbe != nil {
+		env.lagProbe.begin()
+	}
+	var readSplit *readSplitTracker
+	if test.Target == TargetProxy {
+		readSplit = newReadSplitTracker(env.proxyWeights)
+	}
+	readYourWrites := newReadYourWritesTracker(env.loadBalanceMode)
+
+	// Each worker records into its own stats; they are merged once all workers finish
+	stats := make([]*workerStats, concurrency)
 	for w := 0; w < concurrency; w++ {
+		ws := &workerStats{latency: NewHistogram()}
+		stats[w] = ws
+		worker := newWorker(name, w, params)
+		worker.readSplit = readSplit
+		worker.readYourWrites = readYourWrites
+
+		// Latency is measured from opStart, which in open-loop mode is the intended
+		// start time, so time spent queued behind a slow database is included
+		doOp := func(opStart time.Time) {
+			live.startOp()
+			err := workload.Run(db, worker)
+			latency := time.Since(opStart)
+			live.finishOp(latency, err)
+
+			if err != nil {
+				atomic.AddInt64(&progressFailed, 1)
+			} else {
+				atomic.AddInt64(&progressSuccess, 1)
+			}
+
+			if phases.at(opStart) != PhaseSteady {
+				return
+			}
+			ws.latency.Record(latency)
+			ws.total++
+			if err != nil {
+				ws.failed++
+			} else {
+				ws.success++
+			}
+		}
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			if schedule != nil {
+				live.addWorkers(1)
+				defer live.addWorkers(-1)
+
+				for intended := range schedule {
+					if ctx.Err() != nil {
+						return
+					}
+					doOp(intended)
+				}
+				return
+			}
+
+			// Closed loop: workers join evenly over the ramp-up and leave in reverse
+			// order over the ramp-down
+			joinAt := startTime.Add(rampUp * time.Duration(w) / time.Duration(concurrency))
+			leaveAt := phases.steadyEnd.Add(rampDown * time.Duration(concurrency-1-w) / time.Duration(concurrency))
+			if !sleepUntil(ctx, joinAt) {
+				return
+			}
+			live.addWorkers(1)
+			defer live.addWorkers(-1)
+
 			for i := 0; i < opsPerWorker; i++ {
 				select {
 				case <-ctx.Done():
@@ -373,33 +578,11 @@ func runTest(db *sql.DB, name string, concurrency, opsPerWorker int, duration ti
 				default:
 				}
 
-				opStart := time.Now()
-				err := testFn(db)
-				latency := time.Since(opStart)
-
-				atomic.AddInt64(&totalOps, 1)
-				atomic.AddInt64(&totalLatency, int64(latency))
-
-				if err != nil {
-					atomic.AddInt64(&failedOps, 1)
-				} else {
-					atomic.AddInt64(&successOps, 1)
-				}
-
-				// Update min/max latency
-				latencyNs := int64(latency)
-				for {
-					oldMin := atomic.LoadInt64(&minLatency)
-					if latencyNs >= oldMin || atomic.CompareAndSwapInt64(&minLatency, oldMin, latencyNs) {
-						break
-					}
-				}
-				for {
-					oldMax := atomic.LoadInt64(&maxLatency)
-					if latencyNs <= oldMax || atomic.CompareAndSwapInt64(&maxLatency, oldMax, latencyNs) {
-						break
-					}
+				now := time.Now()
+				if rampDown > 0 && !now.Before(leaveAt) {
+					return
 				}
+				doOp(now)
 			}
 		}()
 	}
@@ -407,260 +590,188 @@ func runTest(db *sql.DB, name string, concurrency, opsPerWorker int, duration ti
 	wg.Wait()
 	cancel()
 	<-progressDone
+	var replicationLag *LagStats
+	if env.lagProbe != nil {
+		replicationLag = env.lagProbe.end()
+	}
+	var split *ReadSplit
+	if readSplit != nil {
+		split = readSplit.result()
+	}
+	consistency := readYourWrites.result()
 
-	elapsed := time.Since(startTime)
+	// The steady-state window is cut short if every worker finished its ops early
+	steadyEnd := time.Now()
+	if steadyEnd.After(phases.steadyEnd) {
+		steadyEnd = phases.steadyEnd
+	}
+	elapsed := steadyEnd.Sub(phases.steadyStart)
+	if elapsed <= 0 {
+		// Every worker finished during the ramp-up
+		elapsed = 0
+		logWarning("No operation ran in the steady-state window; raise ops_per_worker or shorten ramp_up")
+	}
 
 	result := TestResult{
-		Name:       name,
-		Duration:   elapsed,
-		TotalOps:   atomic.LoadInt64(&totalOps),
-		SuccessOps: atomic.LoadInt64(&successOps),
-		FailedOps:  atomic.LoadInt64(&failedOps),
+		Name:           name,
+		Duration:       elapsed,
+		Latency:        NewHistogram(),
+		TargetRate:     test.Rate,
+		ReplicationLag: replicationLag,
+		ReadSplit:      split,
+		ReadYourWrites: consistency,
+	}
+	for _, ws := range stats {
+		result.Latency.Merge(ws.latency)
+		result.TotalOps += ws.total
+		result.SuccessOps += ws.success
+		result.FailedOps += ws.failed
+	}
+
+	if test.Rate > 0 && elapsed > 0 {
+		scheduled := int64(elapsed.Seconds() * test.Rate)
+		if limit := int64(concurrency * opsPerWorker); limit > 0 && scheduled > limit {
+			scheduled = limit
+		}
+		if scheduled > result.TotalOps {
+			result.MissedOps = scheduled - result.TotalOps
+		}
 	}
 
 	if result.TotalOps > 0 {
-		result.AvgLatency = time.Duration(atomic.LoadInt64(&totalLatency) / result.TotalOps)
-		result.MinLatency = time.Duration(atomic.LoadInt64(&minLatency))
-		result.MaxLatency = time.Duration(atomic.LoadInt64(&maxLatency))
-		result.OpsPerSecond = float64(result.SuccessOps) / elapsed.Seconds()
+		latency := result.Latency
+		result.AvgLatency = latency.Mean()
+		result.MinLatency = latency.Min()
+		result.MaxLatency = latency.Max()
+		result.P50Latency = latency.Percentile(50)
+		result.P90Latency = latency.Percentile(90)
+		result.P95Latency = latency.Percentile(95)
+		result.P99Latency = latency.Percentile(99)
+		result.P999Latency = latency.Percentile(99.9)
+		if elapsed > 0 {
+			result.OpsPerSecond = float64(result.SuccessOps) / elapsed.Seconds()
+		}
 	}
 
 	printTestResult(result)
+	if result.ReadSplit != nil {
+		printReadSplit(result.ReadSplit)
+	}
+	if result.ReadYourWrites != nil {
+		printReadYourWrites(result.ReadYourWrites)
+	}
 	return result
 }
 
-// Replication Lag Test
-func runReplicationLagTest(primaryDB, replicaDB *sql.DB, testCount int, maxWaitSeconds int) ReplicationResult {
-	result := ReplicationResult{
-		TestCount: testCount,
-		MinLag:    time.Hour,
-		AllLags:   make([]time.Duration, 0, testCount),
+// sleepUntil waits until t and reports false if ctx was done first
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err() == nil
 	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
-	maxWait := time.Duration(maxWaitSeconds) * time.Second
-
-	for i := 0; i < testCount; i++ {
-		// Generate unique ID
-		uuid := fmt.Sprintf("%d-%d-%d", time.Now().UnixNano(), rand.Int63(), i)
-		writeTime := time.Now()
+// scheduleArrivals emits the intended start time of each operation until ctx is
+// done or limit operations (0 = no limit) have been scheduled. The rate climbs
+// linearly from zero to rate over the ramp-up, holds during the steady state and
+// falls back to zero over the ramp-down.
+// The channel is unbuffered: when all workers are busy the schedule falls behind
+// and the backlog is handed out as soon as workers free up, each with its
+// original intended time.
+func scheduleArrivals(ctx context.Context, phases testPhases, rate float64, limit int) <-chan time.Time {
+	schedule := make(chan time.Time)
 
-		// Write to PRIMARY
-		_, err := primaryDB.Exec(`INSERT INTO loadtest_replication (id, write_time, data) VALUES ($1, $2, $3)`,
-			uuid, writeTime, fmt.Sprintf("test_data_%d", i))
-		if err != nil {
-			result.FailedCount++
-			fmt.Printf("   [%d/%d] Write failed: %v\n", i+1, testCount, err)
-			continue
-		}
+	go func() {
+		defer close(schedule)
 
-		// Poll REPLICA until data appears
-		pollStart := time.Now()
-		found := false
-		var readTime time.Time
-
-		for time.Since(pollStart) < maxWait {
-			var count int
-			err := replicaDB.QueryRow(`SELECT COUNT(*) FROM loadtest_replication WHERE id = $1`, uuid).Scan(&count)
-			if err == nil && count > 0 {
-				readTime = time.Now()
-				found = true
-				break
+		for i := 0; limit <= 0 || i < limit; i++ {
+			offset, ok := arrivalOffset(phases, rate, float64(i))
+			if !ok {
+				return
 			}
-			time.Sleep(1 * time.Millisecond) // Poll every 1ms
-		}
+			intended := phases.start.Add(offset)
 
-		if found {
-			lag := readTime.Sub(writeTime)
-			result.SuccessCount++
-			result.AllLags = append(result.AllLags, lag)
-
-			if lag < result.MinLag {
-				result.MinLag = lag
-			}
-			if lag > result.MaxLag {
-				result.MaxLag = lag
+			if !sleepUntil(ctx, intended) {
+				return
 			}
 
-			// Log progress every 10 tests
-			if (i+1)%10 == 0 || i == 0 {
-				fmt.Printf("   [%d/%d] Replication lag: %v\n", i+1, testCount, lag.Round(time.Microsecond))
+			select {
+			case schedule <- intended:
+			case <-ctx.Done():
+				return
 			}
-		} else {
-			result.FailedCount++
-			fmt.Printf("   [%d/%d] Timeout - data not replicated within %v\n", i+1, testCount, maxWait)
-		}
-	}
-
-	// Calculate statistics
-	if len(result.AllLags) > 0 {
-		var totalLag time.Duration
-		for _, lag := range result.AllLags {
-			totalLag += lag
-		}
-		result.AvgLag = totalLag / time.Duration(len(result.AllLags))
-
-		// Sort for percentiles
-		sortedLags := make([]time.Duration, len(result.AllLags))
-		copy(sortedLags, result.AllLags)
-		sortDurations(sortedLags)
-
-		result.P50Lag = sortedLags[len(sortedLags)*50/100]
-		result.P95Lag = sortedLags[len(sortedLags)*95/100]
-		if len(sortedLags) > 0 {
-			result.P99Lag = sortedLags[len(sortedLags)*99/100]
 		}
-	}
-
-	return result
-}
-
-func sortDurations(d []time.Duration) {
-	for i := 0; i < len(d); i++ {
-		for j := i + 1; j < len(d); j++ {
-			if d[j] < d[i] {
-				d[i], d[j] = d[j], d[i]
-			}
+	}()
+
+	return schedule
+}
+
+// arrivalOffset returns when the n-th operation is due, relative to the start of
+// the test, by inverting the cumulative number of arrivals of the ramped rate
+func arrivalOffset(phases testPhases, rate, n float64) (time.Duration, bool) {
+	rampUp := phases.steadyStart.Sub(phases.start).Seconds()
+	steady := phases.steadyEnd.Sub(phases.steadyStart).Seconds()
+	rampDown := phases.end.Sub(phases.steadyEnd).Seconds()
+
+	rampUpOps := rate * rampUp / 2
+	steadyOps := rate * steady
+
+	var t float64
+	switch {
+	case n < rampUpOps:
+		t = math.Sqrt(2 * rampUp * n / rate)
+	case n < rampUpOps+steadyOps:
+		t = rampUp + (n-rampUpOps)/rate
+	default:
+		k := n - rampUpOps - steadyOps
+		if rampDown == 0 || 2*k >= rate*rampDown {
+			return 0, false
 		}
+		t = rampUp + steady + rampDown*(1-math.Sqrt(1-2*k/(rate*rampDown)))
 	}
+	return time.Duration(t * float64(time.Second)), true
 }
 
-func showProgress(ctx context.Context, success, failed *int64, startTime time.Time, done chan bool) {
+func showProgress(ctx context.Context, success, failed *int64, phases testPhases, done chan bool) {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
 	spinChars := []string{"|", "/", "-", "\\"}
 	spinIdx := 0
+	ramped := phases.steadyStart.After(phases.start) || phases.end.After(phases.steadyEnd)
 
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Print("\r                                                                    \r")
+			fmt.Print("\r                                                                                \r")
 			done <- true
 			return
 		case <-ticker.C:
-			elapsed := time.Since(startTime)
+			now := time.Now()
+			elapsed := now.Sub(phases.start)
 			s := atomic.LoadInt64(success)
 			f := atomic.LoadInt64(failed)
 			ops := float64(s) / elapsed.Seconds()
 			spin := spinChars[spinIdx%len(spinChars)]
 			spinIdx++
 
-			fmt.Printf("\r   %s Running... Success: %d | Failed: %d | %.1f ops/s | %v elapsed   ",
-				spin, s, f, ops, elapsed.Round(time.Millisecond))
-		}
-	}
-}
-
-// Test functions
-func testSimpleRead(db *sql.DB) error {
-	id := rand.Intn(1000) + 1
-	var data string
-	var value int
-	return db.QueryRow(`SELECT data, value FROM loadtest_simple WHERE id = $1`, id).Scan(&data, &value)
-}
-
-func testSimpleWrite(db *sql.DB) error {
-	_, err := db.Exec(`INSERT INTO loadtest_simple (data, value) VALUES ($1, $2)`,
-		fmt.Sprintf("test_data_%d", rand.Int63()), rand.Intn(10000))
-	return err
-}
-
-func testMixedOperations(db *sql.DB) error {
-	if rand.Float32() < 0.7 { // 70% reads
-		return testSimpleRead(db)
-	}
-	return testSimpleWrite(db)
-}
-
-func testBatchInsert(db *sql.DB) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare(`INSERT INTO loadtest_simple (data, value) VALUES ($1, $2)`)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	for i := 0; i < 10; i++ {
-		if _, err := stmt.Exec(fmt.Sprintf("batch_%d_%d", time.Now().UnixNano(), i), rand.Intn(10000)); err != nil {
-			return err
-		}
-	}
-
-	return tx.Commit()
-}
-
-func testTimeSeriesInsert(db *sql.DB) error {
-	_, err := db.Exec(`INSERT INTO loadtest_timeseries (time, device_id, temperature, humidity, pressure) 
-		VALUES ($1, $2, $3, $4, $5)`,
-		time.Now(),
-		fmt.Sprintf("device_%d", rand.Intn(100)),
-		20+rand.Float64()*15,
-		30+rand.Float64()*50,
-		1000+rand.Float64()*50)
-	return err
-}
-
-func testTimeRangeQuery(db *sql.DB) error {
-	endTime := time.Now()
-	startTime := endTime.Add(-time.Duration(rand.Intn(60)+1) * time.Minute)
-
-	rows, err := db.Query(`SELECT time, device_id, temperature, humidity, pressure 
-		FROM loadtest_timeseries 
-		WHERE time >= $1 AND time <= $2 
-		ORDER BY time DESC 
-		LIMIT 100`, startTime, endTime)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var t time.Time
-		var deviceID string
-		var temp, humidity, pressure float64
-		if err := rows.Scan(&t, &deviceID, &temp, &humidity, &pressure); err != nil {
-			return err
-		}
-	}
-	return rows.Err()
-}
-
-func testComplexQuery(db *sql.DB) error {
-	deviceID := fmt.Sprintf("device_%d", rand.Intn(10))
-
-	rows, err := db.Query(`
-		SELECT 
-			device_id,
-			COUNT(*) as count,
-			AVG(temperature) as avg_temp,
-			MIN(temperature) as min_temp,
-			MAX(temperature) as max_temp,
-			AVG(humidity) as avg_humidity,
-			AVG(pressure) as avg_pressure
-		FROM loadtest_timeseries
-		WHERE device_id = $1
-		  AND time >= NOW() - INTERVAL '1 hour'
-		GROUP BY device_id
-	`, deviceID)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
+			phase := ""
+			if ramped {
+				phase = "[" + phases.at(now) + "] "
+			}
 
-	for rows.Next() {
-		var id string
-		var count int
-		var avgTemp, minTemp, maxTemp, avgHumidity, avgPressure sql.NullFloat64
-		if err := rows.Scan(&id, &count, &avgTemp, &minTemp, &maxTemp, &avgHumidity, &avgPressure); err != nil {
-			return err
+			fmt.Printf("\r   %s Running... %sSuccess: %d | Failed: %d | %.1f ops/s | %v elapsed   ",
+				spin, phase, s, f, ops, elapsed.Round(time.Millisecond))
 		}
 	}
-	return rows.Err()
 }
 
 // UI Functions
@@ -698,7 +809,7 @@ func printTestHeader(name string) {
 
 func printTestResult(result TestResult) {
 	fmt.Println()
-	successRate := float64(result.SuccessOps) / float64(result.TotalOps) * 100
+	successRate := successPct(result.SuccessOps, result.TotalOps)
 
 	// Status indicator
 	statusIcon := "[OK]"
@@ -716,10 +827,26 @@ func printTestResult(result TestResult) {
 	fmt.Printf("   │ %-20s %d ops                                   │\n", "Successful:", result.SuccessOps)
 	fmt.Printf("   │ %-20s %d ops                                   │\n", "Failed:", result.FailedOps)
 	fmt.Printf("   │ %-20s %.2f ops/sec                             │\n", "Throughput:", result.OpsPerSecond)
+	if result.TargetRate > 0 {
+		fmt.Printf("   │ %-20s %.2f ops/sec                             │\n", "Target Rate:", result.TargetRate)
+		fmt.Printf("   │ %-20s %d ops                                   │\n", "Missed Schedule:", result.MissedOps)
+	}
 	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
 	fmt.Printf("   │ %-20s %v                                  │\n", "Avg Latency:", result.AvgLatency.Round(time.Microsecond))
 	fmt.Printf("   │ %-20s %v                                  │\n", "Min Latency:", result.MinLatency.Round(time.Microsecond))
 	fmt.Printf("   │ %-20s %v                                  │\n", "Max Latency:", result.MaxLatency.Round(time.Microsecond))
+	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
+	fmt.Printf("   │ %-20s %v                                  │\n", "P50 Latency:", result.P50Latency.Round(time.Microsecond))
+	fmt.Printf("   │ %-20s %v                                  │\n", "P90 Latency:", result.P90Latency.Round(time.Microsecond))
+	fmt.Printf("   │ %-20s %v                                  │\n", "P95 Latency:", result.P95Latency.Round(time.Microsecond))
+	fmt.Printf("   │ %-20s %v                                  │\n", "P99 Latency:", result.P99Latency.Round(time.Microsecond))
+	fmt.Printf("   │ %-20s %v                                  │\n", "P99.9 Latency:", result.P999Latency.Round(time.Microsecond))
+	if lag := result.ReplicationLag; lag != nil && lag.SuccessCount > 0 {
+		fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
+		fmt.Printf("   │ %-20s %v                                  │\n", "Avg Repl. Lag:", lag.AvgLag.Round(time.Microsecond))
+		fmt.Printf("   │ %-20s %v                                  │\n", "P99 Repl. Lag:", lag.P99Lag.Round(time.Microsecond))
+		fmt.Printf("   │ %-20s %v                                  │\n", "Max Repl. Lag:", lag.MaxLag.Round(time.Microsecond))
+	}
 	fmt.Println("   └─────────────────────────────────────────────────────────────────┘")
 }
 
@@ -728,18 +855,18 @@ func printFinalReport(results []TestResult) {
 	fmt.Println()
 
 	// Header
-	fmt.Println("   ┌──────────────────────────────────────────┬───────────┬───────────┬───────────┐")
-	fmt.Printf("   │ %-40s │ %-9s │ %-9s │ %-9s │\n", "Test Name", "Ops/Sec", "Avg Lat", "Success%")
-	fmt.Println("   ├──────────────────────────────────────────┼───────────┼───────────┼───────────┤")
+	fmt.Println("   ┌──────────────────────────────────────────┬───────────┬───────────┬───────────┬───────────┐")
+	fmt.Printf("   │ %-40s │ %-9s │ %-9s │ %-9s │ %-9s │\n", "Test Name", "Ops/Sec", "Avg Lat", "P99 Lat", "Success%")
+	fmt.Println("   ├──────────────────────────────────────────┼───────────┼───────────┼───────────┼───────────┤")
 
-	var totalOps, totalSuccess float64
+	var totalOps, totalSuccess int64
 	var bestThroughput, worstThroughput float64 = 0, 999999999
 	var bestTest, worstTest string
 
 	for _, r := range results {
-		successRate := float64(r.SuccessOps) / float64(r.TotalOps) * 100
-		totalOps += float64(r.TotalOps)
-		totalSuccess += float64(r.SuccessOps)
+		successRate := successPct(r.SuccessOps, r.TotalOps)
+		totalOps += r.TotalOps
+		totalSuccess += r.SuccessOps
 
 		if r.OpsPerSecond > bestThroughput {
 			bestThroughput = r.OpsPerSecond
@@ -755,63 +882,52 @@ func printFinalReport(results []TestResult) {
 			name = name[:35] + "..."
 		}
 
-		fmt.Printf("   │ %-40s │ %9.2f │ %9s │ %8.1f%% │\n",
-			name, r.OpsPerSecond, r.AvgLatency.Round(time.Microsecond).String(), successRate)
+		fmt.Printf("   │ %-40s │ %9.2f │ %9s │ %9s │ %8.1f%% │\n",
+			name, r.OpsPerSecond, r.AvgLatency.Round(time.Microsecond).String(), r.P99Latency.Round(time.Microsecond).String(), successRate)
 	}
 
-	fmt.Println("   └──────────────────────────────────────────┴───────────┴───────────┴───────────┘")
+	fmt.Println("   └──────────────────────────────────────────┴───────────┴───────────┴───────────┴───────────┘")
 
 	// Summary stats
 	fmt.Println()
 	fmt.Printf("   [BEST]    Best Throughput: %.2f ops/sec (%s)\n", bestThroughput, bestTest)
 	fmt.Printf("   [SLOW]    Slowest:         %.2f ops/sec (%s)\n", worstThroughput, worstTest)
-	fmt.Printf("   [TOTAL]   Overall Success: %.1f%% (%.0f/%.0f ops)\n", totalSuccess/totalOps*100, totalSuccess, totalOps)
+	fmt.Printf("   [TOTAL]   Overall Success: %.1f%% (%d/%d ops)\n", successPct(totalSuccess, totalOps), totalSuccess, totalOps)
 }
 
-func printReplicationReport(result ReplicationResult) {
-	printSection("Replication Lag Report")
-	fmt.Println()
-
-	successRate := float64(result.SuccessCount) / float64(result.TestCount) * 100
-
-	fmt.Println("   ┌─────────────────────────────────────────────────────────────────┐")
-	fmt.Printf("   │ %-30s %-33d │\n", "Total Tests:", result.TestCount)
-	fmt.Printf("   │ %-30s %-33d │\n", "Successful:", result.SuccessCount)
-	fmt.Printf("   │ %-30s %-33d │\n", "Failed/Timeout:", result.FailedCount)
-	fmt.Printf("   │ %-30s %-32.1f%% │\n", "Success Rate:", successRate)
-	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
-	fmt.Printf("   │ %-30s %-33s │\n", "Average Replication Lag:", result.AvgLag.Round(time.Microsecond))
-	fmt.Printf("   │ %-30s %-33s │\n", "Minimum Replication Lag:", result.MinLag.Round(time.Microsecond))
-	fmt.Printf("   │ %-30s %-33s │\n", "Maximum Replication Lag:", result.MaxLag.Round(time.Microsecond))
-	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
-	fmt.Printf("   │ %-30s %-33s │\n", "P50 (Median) Lag:", result.P50Lag.Round(time.Microsecond))
-	fmt.Printf("   │ %-30s %-33s │\n", "P95 Lag:", result.P95Lag.Round(time.Microsecond))
-	fmt.Printf("   │ %-30s %-33s │\n", "P99 Lag:", result.P99Lag.Round(time.Microsecond))
-	fmt.Println("   └─────────────────────────────────────────────────────────────────┘")
-
-	// Performance assessment
-	fmt.Println()
-	if result.AvgLag < 10*time.Millisecond {
-		fmt.Println("   [EXCELLENT] Replication is very fast! Avg lag < 10ms")
-	} else if result.AvgLag < 100*time.Millisecond {
-		fmt.Println("   [GOOD] Replication is healthy. Avg lag < 100ms")
-	} else if result.AvgLag < 1*time.Second {
-		fmt.Println("   [WARNING] Replication lag is noticeable. Avg lag < 1s")
-	} else {
-		fmt.Println("   [CRITICAL] Replication lag is high! Avg lag > 1s")
+// successPct is the share of successful operations, 0 if none ran
+func successPct(success, total int64) float64 {
+	if total == 0 {
+		return 0
 	}
+	return float64(success) / float64(total) * 100
+}
+
+// DatabaseInfo describes a database node the tool connected to
+type DatabaseInfo struct {
+	Role               string `json:"role"`
+	Host               string `json:"host"`
+	Port               string `json:"port"`
+	Database           string `json:"database"`
+	ServerVersion      string `json:"server_version"`
+	TimescaleDBVersion string `json:"timescaledb_version,omitempty"`
+	InRecovery         bool   `json:"in_recovery"`
 }
 
-func printDatabaseInfo(db *sql.DB) {
+func printDatabaseInfo(db *sql.DB) DatabaseInfo {
+	var info DatabaseInfo
+
 	var version string
 	db.QueryRow("SELECT version()").Scan(&version)
 	logInfo("Version", version)
+	info.ServerVersion = version
 
 	// Check for TimescaleDB
 	var tsVersion string
 	err := db.QueryRow("SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'").Scan(&tsVersion)
 	if err == nil {
 		logInfo("TimescaleDB", "v"+tsVersion+" [OK]")
+		info.TimescaleDBVersion = tsVersion
 	} else {
 		logInfo("TimescaleDB", "Not installed")
 	}
@@ -825,7 +941,10 @@ func printDatabaseInfo(db *sql.DB) {
 		} else {
 			logInfo("Role", "PRIMARY (read-write)")
 		}
+		info.InRecovery = isRecovery
 	}
+
+	return info
 }
 
 func logInfo(label, value string) {
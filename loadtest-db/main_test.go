@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTestPhases(t *testing.T) {
+	start := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	ramped := newTestPhases(start, 10*time.Second, 20*time.Second, 5*time.Second)
+	noRamp := newTestPhases(start, 0, 10*time.Second, 0)
+
+	if ramped.steadyStart != start.Add(10*time.Second) || ramped.steadyEnd != start.Add(30*time.Second) || ramped.end != start.Add(35*time.Second) {
+		t.Fatalf("phases = %+v, want steady state from 10s to 30s and the end at 35s", ramped)
+	}
+
+	tests := []struct {
+		name   string
+		phases testPhases
+		offset time.Duration
+		want   string
+	}{
+		{"before the start", ramped, -time.Second, PhaseRampUp},
+		{"start", ramped, 0, PhaseRampUp},
+		{"ramp-up", ramped, 9999 * time.Millisecond, PhaseRampUp},
+		{"steady start", ramped, 10 * time.Second, PhaseSteady},
+		{"steady", ramped, 20 * time.Second, PhaseSteady},
+		{"steady end", ramped, 30 * time.Second, PhaseRampDown},
+		{"ramp-down", ramped, 34 * time.Second, PhaseRampDown},
+		{"after the end", ramped, time.Minute, PhaseRampDown},
+		{"no ramp start", noRamp, 0, PhaseSteady},
+		{"no ramp steady", noRamp, 9999 * time.Millisecond, PhaseSteady},
+		{"no ramp end", noRamp, 10 * time.Second, PhaseRampDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.phases.at(start.Add(tt.offset)); got != tt.want {
+				t.Errorf("at(+%v) = %s, want %s", tt.offset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuccessPct(t *testing.T) {
+	tests := []struct {
+		success, total int64
+		want           float64
+	}{
+		{0, 0, 0},
+		{0, 10, 0},
+		{5, 10, 50},
+		{10, 10, 100},
+	}
+	for _, tt := range tests {
+		if got := successPct(tt.success, tt.total); got != tt.want {
+			t.Errorf("successPct(%d, %d) = %g, want %g", tt.success, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestArrivalOffset(t *testing.T) {
+	start := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	// 10 ops/s: 50 ops while ramping up, 200 steady and 50 while ramping down
+	ramped := newTestPhases(start, 10*time.Second, 20*time.Second, 10*time.Second)
+	noRamp := newTestPhases(start, 0, 10*time.Second, 0)
+
+	tests := []struct {
+		name   string
+		phases testPhases
+		n      float64
+		want   time.Duration
+		ok     bool
+	}{
+		{"first op", ramped, 0, 0, true},
+		{"ramp-up", ramped, 5, 3162278 * time.Microsecond, true}, // sqrt(10)s
+		{"steady start", ramped, 50, 10 * time.Second, true},
+		{"steady", ramped, 60, 11 * time.Second, true},
+		{"steady end", ramped, 249, 29900 * time.Millisecond, true},
+		{"ramp-down start", ramped, 250, 30 * time.Second, true},
+		{"ramp-down", ramped, 275, 32928932 * time.Microsecond, true}, // 30s + 10s*(1-sqrt(0.5))
+		{"last op", ramped, 299, 38585786 * time.Microsecond, true},   // 30s + 10s*(1-sqrt(0.02))
+		{"end of ramped run", ramped, 300, 0, false},
+		{"no ramp first op", noRamp, 0, 0, true},
+		{"no ramp steady", noRamp, 42, 4200 * time.Millisecond, true},
+		{"no ramp last op", noRamp, 99, 9900 * time.Millisecond, true},
+		{"end of run", noRamp, 100, 0, false},
+		{"past the end", noRamp, 1000, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := arrivalOffset(tt.phases, 10, tt.n)
+			if ok != tt.ok {
+				t.Fatalf("arrivalOffset(n=%g) ok = %v, want %v", tt.n, ok, tt.ok)
+			}
+			if diff := got - tt.want; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("arrivalOffset(n=%g) = %v, want %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArrivalOffsetWithinPhases(t *testing.T) {
+	start := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	phases := newTestPhases(start, 3*time.Second, 5*time.Second, 7*time.Second)
+	// Offsets rise monotonically and every due operation falls inside the test
+	var last time.Duration
+	n := 0
+	for ; ; n++ {
+		at, ok := arrivalOffset(phases, 25, float64(n))
+		if !ok {
+			break
+		}
+		if at < last {
+			t.Fatalf("op %d is due at %v, before op %d at %v", n, at, n-1, last)
+		}
+		if end := phases.end.Sub(phases.start); at > end {
+			t.Fatalf("op %d is due at %v, after the end of the test at %v", n, at, end)
+		}
+		last = at
+	}
+	// 25 ops/s: 37.5 ramping up, 125 steady and 87.5 ramping down
+	if n != 250 {
+		t.Errorf("%d ops scheduled, want 250", n)
+	}
+}
+
+func TestScheduleArrivals(t *testing.T) {
+	// A start in the past makes every arrival due at once
+	start := time.Now().Add(-time.Hour)
+	phases := newTestPhases(start, 0, 10*time.Second, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []time.Time
+	for intended := range scheduleArrivals(ctx, phases, 10, 5) {
+		got = append(got, intended)
+	}
+	if len(got) != 5 {
+		t.Fatalf("%d arrivals scheduled, want the limit of 5", len(got))
+	}
+	for i, intended := range got {
+		if want := start.Add(time.Duration(i) * 100 * time.Millisecond); !intended.Equal(want) {
+			t.Errorf("arrival %d intended at %v, want %v", i, intended, want)
+		}
+	}
+
+	// Without a limit the schedule ends with the test
+	n := 0
+	for range scheduleArrivals(ctx, phases, 10, 0) {
+		n++
+	}
+	if n != 100 {
+		t.Errorf("%d arrivals scheduled in 10s at 10 ops/s, want 100", n)
+	}
+}
+
+func TestScheduleArrivalsStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	schedule := scheduleArrivals(ctx, newTestPhases(time.Now().Add(time.Hour), 0, time.Minute, 0), 10, 0)
+	cancel()
+	select {
+	case _, ok := <-schedule:
+		if ok {
+			t.Fatal("arrival scheduled an hour ahead was handed out")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("schedule not closed after the context was cancelled")
+	}
+}
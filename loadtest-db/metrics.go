@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricBuckets are the upper bounds, in seconds, of the exported latency histograms
+var metricBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricsRegistry holds the live counters served on the Prometheus endpoint. A
+// nil registry, when no endpoint is configured, records nothing.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	tests    map[string]*testMetrics
+	replicas map[string]*latencyMetric
+}
+
+// testMetrics are the live counters of one load test. They cover every phase,
+// unlike TestResult which only counts the steady-state window.
+type testMetrics struct {
+	success  int64
+	errors   int64
+	inflight int64
+	workers  int64
+	latency  latencyMetric
+}
+
+// latencyMetric is a Prometheus-style cumulative histogram updated with atomics
+type latencyMetric struct {
+	buckets []int64 // non-cumulative counts per bucket, plus +Inf
+	sumNs   int64
+	lastNs  int64
+}
+
+func newLatencyMetric() latencyMetric {
+	return latencyMetric{buckets: make([]int64, len(metricBuckets)+1)}
+}
+
+func (l *latencyMetric) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(metricBuckets, seconds)
+	atomic.AddInt64(&l.buckets[i], 1)
+	atomic.AddInt64(&l.sumNs, int64(d))
+	atomic.StoreInt64(&l.lastNs, int64(d))
+}
+
+// startMetricsServer serves the live metrics of a new registry on addr at /metrics
+func startMetricsServer(addr string) (*metricsRegistry, error) {
+	metrics := &metricsRegistry{
+		tests:    map[string]*testMetrics{},
+		replicas: map[string]*latencyMetric{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.write(w)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.ListenAndServe() }()
+
+	// Surface bind errors immediately instead of failing silently mid-run
+	select {
+	case err := <-errCh:
+		return nil, err
+	case <-time.After(100 * time.Millisecond):
+		return metrics, nil
+	}
+}
+
+// test returns the counters for a test, creating them on first use
+func (m *metricsRegistry) test(name string) *testMetrics {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tests[name]
+	if !ok {
+		t = &testMetrics{latency: newLatencyMetric()}
+		m.tests[name] = t
+	}
+	return t
+}
+
+func (m *metricsRegistry) observeReplicationLag(replica string, lag time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	r, ok := m.replicas[replica]
+	if !ok {
+		l := newLatencyMetric()
+		r = &l
+		m.replicas[replica] = r
+	}
+	m.mu.Unlock()
+	r.observe(lag)
+}
+
+func (t *testMetrics) startOp() {
+	if t != nil {
+		atomic.AddInt64(&t.inflight, 1)
+	}
+}
+
+func (t *testMetrics) finishOp(d time.Duration, err error) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.inflight, -1)
+	if err != nil {
+		atomic.AddInt64(&t.errors, 1)
+	} else {
+		atomic.AddInt64(&t.success, 1)
+	}
+	t.latency.observe(d)
+}
+
+// abortOp ends an operation that was cut off by the end of the test without counting it
+func (t *testMetrics) abortOp() {
+	if t != nil {
+		atomic.AddInt64(&t.inflight, -1)
+	}
+}
+
+func (t *testMetrics) addWorkers(n int64) {
+	if t != nil {
+		atomic.AddInt64(&t.workers, n)
+	}
+}
+
+// write renders every metric in the Prometheus text exposition format
+func (m *metricsRegistry) write(w io.Writer) {
+	m.mu.Lock()
+	testNames := sortedKeys(m.tests)
+	replicaNames := sortedKeys(m.replicas)
+	m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP loadtest_operations_total Operations completed per test and result.")
+	fmt.Fprintln(w, "# TYPE loadtest_operations_total counter")
+	for _, name := range testNames {
+		t := m.test(name)
+		fmt.Fprintf(w, "loadtest_operations_total{test=%s,result=\"success\"} %d\n", quoteLabel(name), atomic.LoadInt64(&t.success))
+		fmt.Fprintf(w, "loadtest_operations_total{test=%s,result=\"error\"} %d\n", quoteLabel(name), atomic.LoadInt64(&t.errors))
+	}
+
+	fmt.Fprintln(w, "# HELP loadtest_inflight_operations Operations currently waiting on the database.")
+	fmt.Fprintln(w, "# TYPE loadtest_inflight_operations gauge")
+	for _, name := range testNames {
+		fmt.Fprintf(w, "loadtest_inflight_operations{test=%s} %d\n", quoteLabel(name), atomic.LoadInt64(&m.test(name).inflight))
+	}
+
+	fmt.Fprintln(w, "# HELP loadtest_active_workers Workers currently running.")
+	fmt.Fprintln(w, "# TYPE loadtest_active_workers gauge")
+	for _, name := range testNames {
+		fmt.Fprintf(w, "loadtest_active_workers{test=%s} %d\n", quoteLabel(name), atomic.LoadInt64(&m.test(name).workers))
+	}
+
+	fmt.Fprintln(w, "# HELP loadtest_operation_duration_seconds Operation latency per test.")
+	fmt.Fprintln(w, "# TYPE loadtest_operation_duration_seconds histogram")
+	for _, name := range testNames {
+		m.test(name).latency.write(w, "loadtest_operation_duration_seconds", "test="+quoteLabel(name))
+	}
+
+	fmt.Fprintln(w, "# HELP loadtest_replication_lag_seconds Time from a PRIMARY write until it is visible on a replica.")
+	fmt.Fprintln(w, "# TYPE loadtest_replication_lag_seconds histogram")
+	m.mu.Lock()
+	replicas := make([]*latencyMetric, len(replicaNames))
+	for i, name := range replicaNames {
+		replicas[i] = m.replicas[name]
+	}
+	m.mu.Unlock()
+	for i, name := range replicaNames {
+		replicas[i].write(w, "loadtest_replication_lag_seconds", "replica="+quoteLabel(name))
+	}
+
+	fmt.Fprintln(w, "# HELP loadtest_replication_last_lag_seconds Most recent replication lag sample.")
+	fmt.Fprintln(w, "# TYPE loadtest_replication_last_lag_seconds gauge")
+	for i, name := range replicaNames {
+		fmt.Fprintf(w, "loadtest_replication_last_lag_seconds{replica=%s} %g\n", quoteLabel(name),
+			time.Duration(atomic.LoadInt64(&replicas[i].lastNs)).Seconds())
+	}
+}
+
+// write prints the histogram; _count is the +Inf bucket, so a scrape taken while
+// observations are recorded never shows the two disagreeing
+func (l *latencyMetric) write(w io.Writer, metric, labels string) {
+	var cumulative int64
+	for i, bound := range metricBuckets {
+		cumulative += atomic.LoadInt64(&l.buckets[i])
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", metric, labels, bound, cumulative)
+	}
+	cumulative += atomic.LoadInt64(&l.buckets[len(metricBuckets)])
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", metric, labels, cumulative)
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", metric, labels, time.Duration(atomic.LoadInt64(&l.sumNs)).Seconds())
+	fmt.Fprintf(w, "%s_count{%s} %d\n", metric, labels, cumulative)
+}
+
+func quoteLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
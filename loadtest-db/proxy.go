@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// readSplitTolerance is how many percentage points the observed share of a
+// backend may differ from its configured weight before it is flagged
+const readSplitTolerance = 5.0
+
+// readWeights mirror READ_WEIGHT_PRIMARY and READ_WEIGHT_REPLICA of the proxy.
+// replicas is the number of replicas behind it.
+type readWeights struct {
+	primary  float64
+	replica  float64
+	replicas int
+}
+
+// ReadSplit is the observed distribution of reads over the backends behind the
+// proxy, compared with the Pgpool-II backend weights
+type ReadSplit struct {
+	Backends           []BackendReads `json:"backends"`
+	PrimaryReads       int64          `json:"primary_reads"`
+	ReplicaReads       int64          `json:"replica_reads"`
+	WeightPrimary      float64        `json:"read_weight_primary"`
+	WeightReplica      float64        `json:"read_weight_replica"`
+	ExpectedPrimaryPct float64        `json:"expected_primary_pct"`
+	ObservedPrimaryPct float64        `json:"observed_primary_pct"`
+	WithinTolerance    bool           `json:"within_tolerance"`
+}
+
+// BackendReads counts the reads served by one backend
+type BackendReads struct {
+	Address     string  `json:"address"`
+	Standby     bool    `json:"standby"`
+	Reads       int64   `json:"reads"`
+	ObservedPct float64 `json:"observed_pct"`
+	ExpectedPct float64 `json:"expected_pct"`
+}
+
+// readSplitTracker counts which backend served each read of the running test
+type readSplitTracker struct {
+	weights  readWeights
+	mu       sync.Mutex
+	backends map[string]*BackendReads
+}
+
+func newReadSplitTracker(weights readWeights) *readSplitTracker {
+	return &readSplitTracker{weights: weights, backends: map[string]*BackendReads{}}
+}
+
+// record counts a read served by the backend at addr. Read workloads of proxy
+// tests select inet_server_addr(), inet_server_port() and pg_is_in_recovery() in
+// the same statement, so the backend is the one Pgpool-II routed that statement to.
+func (t *readSplitTracker) record(addr string, port int, standby bool) {
+	key := fmt.Sprintf("%s:%d", addr, port)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.backends[key]
+	if !ok {
+		b = &BackendReads{Address: key, Standby: standby}
+		t.backends[key] = b
+	}
+	b.Reads++
+}
+
+// result compares the observed split with the share Pgpool-II should give each
+// backend: its weight divided by the sum of all weights. Standbys that were
+// observed but not configured as replicas count too.
+func (t *readSplitTracker) result() *ReadSplit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	weightPrimary, weightReplica, replicas := t.weights.primary, t.weights.replica, t.weights.replicas
+
+	split := &ReadSplit{WeightPrimary: weightPrimary, WeightReplica: weightReplica, WithinTolerance: true}
+	standbys := 0
+	for _, key := range sortedKeys(t.backends) {
+		b := *t.backends[key]
+		if b.Standby {
+			standbys++
+			split.ReplicaReads += b.Reads
+		} else {
+			split.PrimaryReads += b.Reads
+		}
+		split.Backends = append(split.Backends, b)
+	}
+	total := split.PrimaryReads + split.ReplicaReads
+	if total == 0 {
+		return split
+	}
+
+	if standbys > replicas {
+		replicas = standbys
+	}
+	totalWeight := weightPrimary + float64(replicas)*weightReplica
+	if totalWeight > 0 {
+		split.ExpectedPrimaryPct = weightPrimary / totalWeight * 100
+	}
+	split.ObservedPrimaryPct = float64(split.PrimaryReads) / float64(total) * 100
+
+	for i := range split.Backends {
+		b := &split.Backends[i]
+		b.ObservedPct = float64(b.Reads) / float64(total) * 100
+		if totalWeight > 0 {
+			if b.Standby {
+				b.ExpectedPct = weightReplica / totalWeight * 100
+			} else {
+				b.ExpectedPct = split.ExpectedPrimaryPct
+			}
+		}
+		if math.Abs(b.ObservedPct-b.ExpectedPct) > readSplitTolerance {
+			split.WithinTolerance = false
+		}
+	}
+	if math.Abs(split.ObservedPrimaryPct-split.ExpectedPrimaryPct) > readSplitTolerance {
+		split.WithinTolerance = false
+	}
+
+	// Busiest backend first
+	sort.SliceStable(split.Backends, func(i, j int) bool { return split.Backends[i].Reads > split.Backends[j].Reads })
+	return split
+}
+
+func printReadSplit(split *ReadSplit) {
+	fmt.Println()
+	total := split.PrimaryReads + split.ReplicaReads
+	if total == 0 {
+		fmt.Println("   [SPLIT]   No reads with a known backend (write-only workload?)")
+		return
+	}
+
+	fmt.Printf("   Read split through PROXY (READ_WEIGHT_PRIMARY=%g, READ_WEIGHT_REPLICA=%g):\n", split.WeightPrimary, split.WeightReplica)
+	fmt.Println("   ┌──────────────────────────┬─────────┬────────────┬───────────┬───────────┐")
+	fmt.Printf("   │ %-24s │ %-7s │ %-10s │ %-9s │ %-9s │\n", "Backend", "Role", "Reads", "Observed", "Expected")
+	fmt.Println("   ├──────────────────────────┼─────────┼────────────┼───────────┼───────────┤")
+	for _, b := range split.Backends {
+		role := "primary"
+		if b.Standby {
+			role = "replica"
+		}
+		fmt.Printf("   │ %-24s │ %-7s │ %10d │ %8.1f%% │ %8.1f%% │\n", b.Address, role, b.Reads, b.ObservedPct, b.ExpectedPct)
+	}
+	fmt.Println("   └──────────────────────────┴─────────┴────────────┴───────────┴───────────┘")
+
+	if split.WithinTolerance {
+		fmt.Printf("   %s[OK]%s Read split matches the backend weights within %.0f points\n", Green, Reset, readSplitTolerance)
+	} else {
+		fmt.Printf("   %s[WARN]%s Read split differs from the backend weights by more than %.0f points (PRIMARY %.1f%%, expected %.1f%%)\n",
+			Yellow, Reset, readSplitTolerance, split.ObservedPrimaryPct, split.ExpectedPrimaryPct)
+	}
+}
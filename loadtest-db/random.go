@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// runSeed feeds the random generators of the workers and of the seed data, so
+// a run can be repeated with the same keys and seed rows
+var runSeed int64
+
+// initRunSeed takes the run seed from RANDOM_SEED, or from the clock if unset, and prints it
+func initRunSeed(cfg Config) {
+	runSeed = cfg.RandomSeed
+	if runSeed == 0 {
+		runSeed = time.Now().UnixNano()
+	}
+	logInfo("Random Seed", fmt.Sprintf("%d (repeat this run with RANDOM_SEED=%d)", runSeed, runSeed))
+}
+
+// derivedRand returns a generator whose sequence depends only on the run seed
+// and the labels naming what it is for, e.g. a worker of a test
+func derivedRand(labels ...any) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprint(h, runSeed)
+	for _, l := range labels {
+		fmt.Fprint(h, "/", l)
+	}
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
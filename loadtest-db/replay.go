@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query replay
+//
+// A replay file is a query mix captured from production: a CSV or JSON export
+// of pg_stat_statements, or a hand-written file in the same shape. Each entry
+// has the normalized query ($1, $2, ... for constants), how often it was
+// called and optionally total_exec_time (ms) and samples of its parameters:
+//
+//	\copy (SELECT query, calls, total_exec_time FROM pg_stat_statements WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())) TO 'mix.csv' CSV HEADER
+//
+// The replay workload picks a query per operation with probability
+// proportional to its calls, and a random parameter sample for it. Entries
+// that cannot be replayed are left out, and the test fails if they account
+// for more than replayMaxSkippedShare of the captured calls, since the
+// replayed mix would then no longer match the capture.
+
+// replayMaxSkippedShare is the largest share of captured calls that may be
+// skipped
+const replayMaxSkippedShare = 0.05
+
+// replayQuery is one entry of a replay file
+type replayQuery struct {
+	Query         string  `json:"query"`
+	Calls         int64   `json:"calls"`
+	TotalExecTime float64 `json:"total_exec_time,omitempty"` // ms
+	Params        [][]any `json:"params,omitempty"`
+}
+
+// replayMix is a loaded replay file, ready to sample from
+type replayMix struct {
+	queries  []replayQuery
+	cumCalls []int64 // running total of calls, for weighted choice
+
+	skipped      int   // entries that cannot be replayed
+	skippedCalls int64 // their captured calls
+}
+
+// replayedShare is the share of the captured calls that the mix replays
+func (m *replayMix) replayedShare() float64 {
+	replayed := m.cumCalls[len(m.cumCalls)-1]
+	return float64(replayed) / float64(replayed+m.skippedCalls)
+}
+
+// replayWorkload replays the query mix of params.replay
+type replayWorkload struct {
+	mu    sync.Mutex
+	mixes map[string]*replayMix
+}
+
+func init() {
+	registerWorkload("replay", &replayWorkload{mixes: map[string]*replayMix{}})
+}
+
+func (r *replayWorkload) Description() string {
+	return "Replay a pg_stat_statements / CSV query mix by call frequency (replay: file)"
+}
+
+func (r *replayWorkload) Defaults() WorkloadParams { return WorkloadParams{} }
+
+func (r *replayWorkload) Setup(db *sql.DB, params WorkloadParams) error {
+	if params.Replay == "" {
+		return fmt.Errorf("replay needs params.replay")
+	}
+	mix, err := loadReplayMix(params.Replay)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	var execMs float64
+	for _, q := range mix.queries {
+		total += q.Calls
+		execMs += q.TotalExecTime
+	}
+	logInfo("Replay", fmt.Sprintf("%d queries, %d captured calls from %s, %.1f%% of the captured calls",
+		len(mix.queries), total, params.Replay, mix.replayedShare()*100))
+	if mix.skipped > 0 {
+		logWarning(fmt.Sprintf("Skipped %d entries (%d calls) without parameter samples or with transaction control", mix.skipped, mix.skippedCalls))
+	}
+	if 1-mix.replayedShare() > replayMaxSkippedShare {
+		return fmt.Errorf("replay: only %.1f%% of the captured calls can be replayed, at least %.0f%% needed; add params samples to the queries with placeholders",
+			mix.replayedShare()*100, (1-replayMaxSkippedShare)*100)
+	}
+	if window := time.Duration(params.CaptureWindow); window > 0 {
+		logInfo("Captured load", fmt.Sprintf("%.1f calls/s, %.1f queries in flight on average",
+			float64(total)/window.Seconds(), execMs/float64(window.Milliseconds())))
+	}
+
+	r.mu.Lock()
+	r.mixes[params.Replay] = mix
+	r.mu.Unlock()
+	return nil
+}
+
+// ReadOnly reports whether every query of the replay file only reads
+func (r *replayWorkload) ReadOnly(params WorkloadParams) bool {
+	if params.Replay == "" {
+		return false
+	}
+	mix, err := loadReplayMix(params.Replay)
+	if err != nil {
+		return false
+	}
+	for _, q := range mix.queries {
+		if !isReadOnlySQL(q.Query) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *replayWorkload) Teardown(db *sql.DB, params WorkloadParams) error {
+	r.mu.Lock()
+	delete(r.mixes, params.Replay)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *replayWorkload) Run(db *sql.DB, w *Worker) error {
+	mix, ok := w.State.(*replayMix)
+	if !ok {
+		r.mu.Lock()
+		mix = r.mixes[w.Params.Replay]
+		r.mu.Unlock()
+		w.State = mix
+	}
+
+	n := w.Rand.Int63n(mix.cumCalls[len(mix.cumCalls)-1])
+	q := mix.queries[sort.Search(len(mix.cumCalls), func(i int) bool { return mix.cumCalls[i] > n })]
+	var args []any
+	if len(q.Params) > 0 {
+		args = q.Params[w.Rand.Intn(len(q.Params))]
+	}
+	_, err := db.Exec(q.Query, args...)
+	return err
+}
+
+// replayConcurrency sets the concurrency of a replay test that leaves it unset
+// to the mean number of queries in flight during the capture: total execution
+// time divided by capture_window
+func (t *ScenarioTest) replayConcurrency() error {
+	if t.Workload != "replay" || t.Concurrency != 0 || t.Search != nil || t.Params.Replay == "" {
+		return nil
+	}
+	if t.Params.CaptureWindow <= 0 {
+		return fmt.Errorf("test %q: set concurrency, or capture_window to derive it from the replay file", t.Name)
+	}
+	mix, err := loadReplayMix(t.Params.Replay)
+	if err != nil {
+		return fmt.Errorf("test %q: %w", t.Name, err)
+	}
+	var execMs float64
+	for _, q := range mix.queries {
+		execMs += q.TotalExecTime
+	}
+	if execMs == 0 {
+		return fmt.Errorf("test %q: replay file has no total_exec_time to derive concurrency from", t.Name)
+	}
+	t.Concurrency = int(math.Ceil(execMs / float64(time.Duration(t.Params.CaptureWindow).Milliseconds())))
+	return nil
+}
+
+// replayPlaceholder matches the $n parameters of a normalized query. It is
+// only applied outside quoted text.
+var replayPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+// replayParams returns the highest $n parameter of query
+func replayParams(query string) int {
+	want := 0
+	mapUnquoted(query, func(part string) string {
+		for _, m := range replayPlaceholder.FindAllStringSubmatch(part, -1) {
+			if n, _ := strconv.Atoi(m[1]); n > want {
+				want = n
+			}
+		}
+		return part
+	})
+	return want
+}
+
+// loadReplayMix reads a .json replay file (an array of entries) or a CSV file
+// with a header row
+func loadReplayMix(path string) (*replayMix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay file: %w", err)
+	}
+
+	var entries []replayQuery
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&entries); err != nil {
+			return nil, fmt.Errorf("failed to parse replay file %q: %w", path, err)
+		}
+	} else if entries, err = parseReplayCSV(data); err != nil {
+		return nil, fmt.Errorf("failed to parse replay file %q: %w", path, err)
+	}
+
+	mix := &replayMix{}
+	var total int64
+	for _, q := range entries {
+		q.Query = strings.TrimSpace(q.Query)
+		if q.Query == "" || q.Calls <= 0 {
+			continue
+		}
+		// Pooled connections must not be left inside a transaction
+		if transactionControl(q.Query) != "" {
+			mix.skipped++
+			mix.skippedCalls += q.Calls
+			continue
+		}
+		want := replayParams(q.Query)
+		if want > 0 && len(q.Params) == 0 {
+			mix.skipped++
+			mix.skippedCalls += q.Calls
+			continue
+		}
+		for i, sample := range q.Params {
+			if len(sample) != want {
+				return nil, fmt.Errorf("%s: query %.40q: parameter sample %d has %d values, want %d", path, q.Query, i+1, len(sample), want)
+			}
+			for j, v := range sample {
+				sample[j] = replayValue(v)
+			}
+		}
+		total += q.Calls
+		mix.queries = append(mix.queries, q)
+		mix.cumCalls = append(mix.cumCalls, total)
+	}
+	if len(mix.queries) == 0 {
+		return nil, fmt.Errorf("%s: no replayable queries (queries with $n parameters need params samples)", path)
+	}
+	return mix, nil
+}
+
+// parseReplayCSV reads a CSV with the columns query and calls, and optionally
+// total_exec_time (total_time before PostgreSQL 13) and params, a JSON array
+// of parameter samples such as [[1, "device_3"], [42, "device_7"]]. Other
+// columns of a pg_stat_statements export are ignored.
+func parseReplayCSV(data []byte) ([]replayQuery, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	queryCol, ok := cols["query"]
+	if !ok {
+		return nil, fmt.Errorf("missing query column")
+	}
+	callsCol, ok := cols["calls"]
+	if !ok {
+		return nil, fmt.Errorf("missing calls column")
+	}
+	timeCol, ok := cols["total_exec_time"]
+	if !ok {
+		timeCol, ok = cols["total_time"]
+	}
+	if !ok {
+		timeCol = -1
+	}
+	paramsCol, ok := cols["params"]
+	if !ok {
+		paramsCol = -1
+	}
+
+	field := func(rec []string, i int) string {
+		if i < 0 || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var entries []replayQuery
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		q := replayQuery{Query: field(rec, queryCol)}
+		if q.Calls, err = strconv.ParseInt(field(rec, callsCol), 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: calls must be an integer", line)
+		}
+		if s := field(rec, timeCol); s != "" {
+			if q.TotalExecTime, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("line %d: total_exec_time must be a number", line)
+			}
+		}
+		if s := field(rec, paramsCol); s != "" {
+			dec := json.NewDecoder(strings.NewReader(s))
+			dec.UseNumber()
+			if err := dec.Decode(&q.Params); err != nil {
+				return nil, fmt.Errorf("line %d: params must be a JSON array of arrays: %w", line, err)
+			}
+		}
+		entries = append(entries, q)
+	}
+	return entries, nil
+}
+
+// replayValue converts a decoded JSON parameter to a bind value. Numbers keep
+// their text so integers stay integers; arrays and objects are sent as JSON.
+func replayValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		return v.String()
+	case []any, map[string]any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeReplayFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplayParams(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"SELECT 1", 0},
+		{"SELECT * FROM t WHERE id = $1 AND x = $2", 2},
+		{"SELECT $3, $1", 3},
+		{"SELECT '$1 costs $2'", 0},
+		{"SELECT 'a', $1, E'\\'$4'", 1},
+		{"SELECT $$ $5 $$, $1", 1},
+		{"DO $body$ BEGIN PERFORM $2; END $body$", 0},
+		{`SELECT "$9" FROM t WHERE id = $2`, 2},
+	}
+	for _, tt := range tests {
+		if got := replayParams(tt.query); got != tt.want {
+			t.Errorf("replayParams(%q) = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestLoadReplayMixSkips(t *testing.T) {
+	path := writeReplayFile(t, "mix.csv", `query,calls,total_exec_time,params
+"SELECT data FROM loadtest_simple WHERE id = $1",600,10,"[[1], [2]]"
+"SELECT count(*) FROM loadtest_simple WHERE data <> '$1'",200,5,
+"UPDATE loadtest_simple SET value = $1 WHERE id = $2",150,5,
+BEGIN,50,1,
+`)
+	mix, err := loadReplayMix(path)
+	if err != nil {
+		t.Fatalf("loadReplayMix: %v", err)
+	}
+	if len(mix.queries) != 2 || mix.skipped != 2 || mix.skippedCalls != 200 {
+		t.Errorf("%d queries, %d skipped with %d calls, want 2, 2 and 200", len(mix.queries), mix.skipped, mix.skippedCalls)
+	}
+	if got := mix.replayedShare(); math.Abs(got-0.8) > 1e-9 {
+		t.Errorf("replayedShare() = %g, want 0.8", got)
+	}
+	if got := mix.cumCalls; len(got) != 2 || got[0] != 600 || got[1] != 800 {
+		t.Errorf("cumCalls = %v, want [600 800]", got)
+	}
+}
+
+func TestReplaySetupFailsWhenMostCallsAreSkipped(t *testing.T) {
+	// A plain pg_stat_statements export: placeholders but no params column
+	path := writeReplayFile(t, "mix.csv", `query,calls,total_exec_time
+"SELECT data FROM loadtest_simple WHERE id = $1",9000,10
+"SELECT count(*) FROM loadtest_simple",100,5
+`)
+	r := &replayWorkload{mixes: map[string]*replayMix{}}
+	if err := r.Setup(nil, WorkloadParams{Replay: path}); err == nil {
+		t.Error("Setup succeeded with 1% of the calls replayable, want an error")
+	}
+
+	path = writeReplayFile(t, "ok.csv", `query,calls,total_exec_time
+"SELECT data FROM loadtest_simple WHERE id = $1",4,10
+"SELECT count(*) FROM loadtest_simple",96,5
+`)
+	if err := r.Setup(nil, WorkloadParams{Replay: path}); err != nil {
+		t.Errorf("Setup with 96%% of the calls replayable: %v", err)
+	}
+}
+
+func TestLoadReplayMixJSON(t *testing.T) {
+	path := writeReplayFile(t, "mix.json", `[
+		{"query": "SELECT $1::int + $2", "calls": 3, "params": [[1, 2], [3, 4]]},
+		{"query": "SELECT 1", "calls": 0}
+	]`)
+	mix, err := loadReplayMix(path)
+	if err != nil {
+		t.Fatalf("loadReplayMix: %v", err)
+	}
+	if len(mix.queries) != 1 {
+		t.Fatalf("%d queries, want 1 (entries without calls are dropped)", len(mix.queries))
+	}
+	if v, ok := mix.queries[0].Params[1][0].(string); !ok || v != "3" {
+		t.Errorf("first value of the second sample = %#v, want the number text \"3\"", mix.queries[0].Params[1][0])
+	}
+
+	bad := writeReplayFile(t, "bad.json", `[{"query": "SELECT $1, $2", "calls": 1, "params": [[1]]}]`)
+	if _, err := loadReplayMix(bad); err == nil {
+		t.Error("loadReplayMix accepted a sample with too few values")
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LagStats summarises a set of replication lag samples
+type LagStats struct {
+	TestCount    int             `json:"test_count"`
+	SuccessCount int             `json:"success_count"`
+	FailedCount  int             `json:"failed_count"`
+	AvgLag       time.Duration   `json:"avg_lag_ns"`
+	MinLag       time.Duration   `json:"min_lag_ns"`
+	MaxLag       time.Duration   `json:"max_lag_ns"`
+	P50Lag       time.Duration   `json:"p50_lag_ns"`
+	P95Lag       time.Duration   `json:"p95_lag_ns"`
+	P99Lag       time.Duration   `json:"p99_lag_ns"`
+	AllLags      []time.Duration `json:"lags_ns"`
+}
+
+// ReplicationResult holds replication lag test results. The embedded LagStats
+// measure the time until a write is visible on every replica, LSNLag the time
+// until every replica has replayed the WAL of the write; Replicas breaks both
+// down per replica.
+type ReplicationResult struct {
+	LagStats
+	LSNLag     LagStats           `json:"lsn_lag"`
+	Replicas   []ReplicaLagResult `json:"replicas"`
+	WALSenders []WALSenderStats   `json:"wal_senders,omitempty"`
+
+	Assertions *ReplicationAssertions `json:"assertions,omitempty"`
+	Violations []string               `json:"slo_violations,omitempty"`
+}
+
+// ReplicaLagResult is the lag of a single replica
+type ReplicaLagResult struct {
+	Name string `json:"name"`
+	Host string `json:"host"`
+	LagStats
+	LSNLag LagStats `json:"lsn_lag"`
+}
+
+// WALSenderStats summarises the pg_stat_replication samples of one standby, as
+// seen by the primary. Lag averages only cover samples where the column was set.
+type WALSenderStats struct {
+	ApplicationName string        `json:"application_name"`
+	ClientAddr      string        `json:"client_addr"`
+	State           string        `json:"state"`
+	Samples         int           `json:"samples"`
+	AvgWriteLag     time.Duration `json:"avg_write_lag_ns"`
+	MaxWriteLag     time.Duration `json:"max_write_lag_ns"`
+	AvgFlushLag     time.Duration `json:"avg_flush_lag_ns"`
+	MaxFlushLag     time.Duration `json:"max_flush_lag_ns"`
+	AvgReplayLag    time.Duration `json:"avg_replay_lag_ns"`
+	MaxReplayLag    time.Duration `json:"max_replay_lag_ns"`
+	MaxReplayBytes  int64         `json:"max_replay_lag_bytes"`
+}
+
+// walSenderSampleInterval is how often pg_stat_replication is sampled
+const walSenderSampleInterval = time.Second
+
+// ReplicaConfig is the address of one replica
+type ReplicaConfig struct {
+	Name string
+	Host string
+	Port string
+}
+
+// replicaConfigs lists the configured replicas, named replica-1, replica-2, ...
+// REPLICA_HOSTS entries are host or host:port, separated by commas.
+func (c Config) replicaConfigs() []ReplicaConfig {
+	var hosts []string
+	if c.ReplicaHosts != "" {
+		for _, h := range strings.Split(c.ReplicaHosts, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hosts = append(hosts, h)
+			}
+		}
+	} else {
+		for _, h := range []string{c.ReplicaHost, c.ReplicaHost2} {
+			if h != "" {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+
+	replicas := make([]ReplicaConfig, 0, len(hosts))
+	for i, h := range hosts {
+		host, port := h, c.ReplicaPort
+		if hh, pp, err := net.SplitHostPort(h); err == nil {
+			host, port = hh, pp
+		}
+		replicas = append(replicas, ReplicaConfig{Name: fmt.Sprintf("replica-%d", i+1), Host: host, Port: port})
+	}
+	return replicas
+}
+
+// replicaConn is an open connection to one replica
+type replicaConn struct {
+	Name string
+	Host string
+	DB   *sql.DB
+}
+
+// ensureReplicationTable creates the replication lag table in schema if it is
+// missing and reports whether it had to be created
+func ensureReplicationTable(db *sql.DB, schema string) (bool, error) {
+	table := qualify(schema, "loadtest_replication")
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	_, err := db.Exec(`CREATE TABLE ` + table + ` (
+		id TEXT PRIMARY KEY,
+		write_time TIMESTAMPTZ NOT NULL,
+		data TEXT
+	)`)
+	return err == nil, err
+}
+
+// runReplicationLagTest writes rows to PRIMARY and polls every replica
+// concurrently until each row shows up there and until the replica has replayed
+// the primary's WAL position after the write. pg_stat_replication is sampled
+// on PRIMARY for the duration of the test.
+func runReplicationLagTest(primaryDB *sql.DB, replicas []replicaConn, testCount int, maxWaitSeconds int, metrics *metricsRegistry) ReplicationResult {
+	maxWait := time.Duration(maxWaitSeconds) * time.Second
+
+	stopSampling := make(chan struct{})
+	walSenders := make(chan []WALSenderStats, 1)
+	go func() { walSenders <- sampleWALSenders(primaryDB, walSenderSampleInterval, stopSampling) }()
+
+	allLags := make([]time.Duration, 0, testCount)
+	replicaLags := make([][]time.Duration, len(replicas))
+	replicaFailed := make([]int, len(replicas))
+	failed := 0
+
+	allLSNLags := make([]time.Duration, 0, testCount)
+	replicaLSNLags := make([][]time.Duration, len(replicas))
+	replicaLSNFailed := make([]int, len(replicas))
+	lsnFailed := 0
+
+	r := derivedRand("replication")
+	for i := 0; i < testCount; i++ {
+		// Generate unique ID
+		uuid := fmt.Sprintf("%d-%d-%d", time.Now().UnixNano(), r.Int63(), i)
+		writeTime := time.Now()
+
+		// Write to PRIMARY
+		_, err := primaryDB.Exec(`INSERT INTO loadtest_replication (id, write_time, data) VALUES ($1, $2, $3)`,
+			uuid, writeTime, fmt.Sprintf("test_data_%d", i))
+		if err != nil {
+			failed++
+			lsnFailed++
+			for r := range replicas {
+				replicaFailed[r]++
+				replicaLSNFailed[r]++
+			}
+			fmt.Printf("   [%d/%d] Write failed: %v\n", i+1, testCount, err)
+			continue
+		}
+
+		// WAL position on PRIMARY that includes the write
+		var lsn string
+		lsnErr := primaryDB.QueryRow(`SELECT pg_current_wal_lsn()::text`).Scan(&lsn)
+
+		// Poll every REPLICA until data appears and until the WAL position is replayed
+		lags := make([]time.Duration, len(replicas))
+		found := make([]bool, len(replicas))
+		lsnLags := make([]time.Duration, len(replicas))
+		replayed := make([]bool, len(replicas))
+		var wg sync.WaitGroup
+		for r, replica := range replicas {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if lsnErr != nil {
+					lags[r], found[r] = pollReplica(replica.DB, uuid, writeTime, maxWait)
+					return
+				}
+				lags[r], found[r], lsnLags[r], replayed[r] = pollReplicaWithLSN(replica.DB, uuid, lsn, writeTime, maxWait)
+			}()
+		}
+		wg.Wait()
+
+		var slowestLSN time.Duration
+		allReplayed := true
+		for r := range replicas {
+			if !replayed[r] {
+				allReplayed = false
+				replicaLSNFailed[r]++
+				continue
+			}
+			replicaLSNLags[r] = append(replicaLSNLags[r], lsnLags[r])
+			if lsnLags[r] > slowestLSN {
+				slowestLSN = lsnLags[r]
+			}
+		}
+		if allReplayed {
+			allLSNLags = append(allLSNLags, slowestLSN)
+		} else {
+			lsnFailed++
+		}
+
+		// The write is replicated once it is visible on the slowest replica
+		var slowest time.Duration
+		allFound := true
+		var progress []string
+		for r, replica := range replicas {
+			if !found[r] {
+				allFound = false
+				replicaFailed[r]++
+				progress = append(progress, replica.Name+" timeout")
+				continue
+			}
+			metrics.observeReplicationLag(replica.Name, lags[r])
+			replicaLags[r] = append(replicaLags[r], lags[r])
+			if lags[r] > slowest {
+				slowest = lags[r]
+			}
+			progress = append(progress, fmt.Sprintf("%s %v", replica.Name, lags[r].Round(time.Microsecond)))
+		}
+
+		if allFound {
+			allLags = append(allLags, slowest)
+
+			// Log progress every 10 tests
+			if (i+1)%10 == 0 || i == 0 {
+				lsnProgress := "timeout"
+				if allReplayed {
+					lsnProgress = slowestLSN.Round(time.Microsecond).String()
+				}
+				if len(replicas) == 1 {
+					fmt.Printf("   [%d/%d] Replication lag: %v (LSN replay: %s)\n", i+1, testCount, slowest.Round(time.Microsecond), lsnProgress)
+				} else {
+					fmt.Printf("   [%d/%d] Replication lag: %s (LSN replay: %s)\n", i+1, testCount, strings.Join(progress, " | "), lsnProgress)
+				}
+			}
+		} else {
+			failed++
+			fmt.Printf("   [%d/%d] Timeout - data not replicated within %v (%s)\n", i+1, testCount, maxWait, strings.Join(progress, " | "))
+		}
+	}
+
+	close(stopSampling)
+
+	result := ReplicationResult{
+		LagStats:   newLagStats(testCount, failed, allLags),
+		LSNLag:     newLagStats(testCount, lsnFailed, allLSNLags),
+		WALSenders: <-walSenders,
+	}
+	for r, replica := range replicas {
+		result.Replicas = append(result.Replicas, ReplicaLagResult{
+			Name:     replica.Name,
+			Host:     replica.Host,
+			LagStats: newLagStats(testCount, replicaFailed[r], replicaLags[r]),
+			LSNLag:   newLagStats(testCount, replicaLSNFailed[r], replicaLSNLags[r]),
+		})
+	}
+	return result
+}
+
+// pollReplica waits until the row with id is visible on the replica and returns
+// the time since writeTime
+func pollReplica(db *sql.DB, id string, writeTime time.Time, maxWait time.Duration) (time.Duration, bool) {
+	pollStart := time.Now()
+	for time.Since(pollStart) < maxWait {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM loadtest_replication WHERE id = $1`, id).Scan(&count)
+		if err == nil && count > 0 {
+			return time.Since(writeTime), true
+		}
+		time.Sleep(1 * time.Millisecond) // Poll every 1ms
+	}
+	return 0, false
+}
+
+// pollReplicaWithLSN is pollReplica that also waits until the replica has
+// replayed the WAL up to lsn. Both are checked by the same query, so measuring
+// the LSN replay lag adds no queries to the standby. The LSN lag is given up on
+// at once if the node is not a standby, since pg_last_wal_replay_lsn() is then NULL.
+func pollReplicaWithLSN(db *sql.DB, id, lsn string, writeTime time.Time, maxWait time.Duration) (lag time.Duration, found bool, lsnLag time.Duration, replayed bool) {
+	lsnDone := false
+	pollStart := time.Now()
+	for time.Since(pollStart) < maxWait {
+		var visible bool
+		var caughtUp sql.NullBool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM loadtest_replication WHERE id = $1), pg_last_wal_replay_lsn() >= $2::pg_lsn`,
+			id, lsn).Scan(&visible, &caughtUp)
+		if err == nil {
+			if !lsnDone && (!caughtUp.Valid || caughtUp.Bool) {
+				lsnDone = true
+				if caughtUp.Bool {
+					lsnLag, replayed = time.Since(writeTime), true
+				}
+			}
+			if !found && visible {
+				lag, found = time.Since(writeTime), true
+			}
+			if found && lsnDone {
+				return lag, found, lsnLag, replayed
+			}
+		}
+		time.Sleep(1 * time.Millisecond) // Poll every 1ms
+	}
+	return lag, found, lsnLag, replayed
+}
+
+// walSenderAcc accumulates pg_stat_replication samples of one standby
+type walSenderAcc struct {
+	stats                       WALSenderStats
+	writeSum, flushSum, replSum time.Duration
+	writeN, flushN, replN       int
+}
+
+// sampleWALSenders samples pg_stat_replication on db every interval until stop
+// is closed, then returns one summary per standby
+func sampleWALSenders(db *sql.DB, interval time.Duration, stop <-chan struct{}) []WALSenderStats {
+	senders := map[string]*walSenderAcc{}
+	var order []string
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		rows, err := db.Query(`SELECT COALESCE(application_name, ''), COALESCE(host(client_addr), ''), COALESCE(state, ''),
+			EXTRACT(EPOCH FROM write_lag), EXTRACT(EPOCH FROM flush_lag), EXTRACT(EPOCH FROM replay_lag),
+			pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)
+			FROM pg_stat_replication`)
+		if err == nil {
+			for rows.Next() {
+				var name, addr, state string
+				var writeLag, flushLag, replayLag, replayBytes sql.NullFloat64
+				if rows.Scan(&name, &addr, &state, &writeLag, &flushLag, &replayLag, &replayBytes) != nil {
+					continue
+				}
+				key := name + "@" + addr
+				acc, ok := senders[key]
+				if !ok {
+					acc = &walSenderAcc{stats: WALSenderStats{ApplicationName: name, ClientAddr: addr}}
+					senders[key] = acc
+					order = append(order, key)
+				}
+				acc.stats.State = state
+				acc.stats.Samples++
+				observeLag(writeLag, &acc.writeSum, &acc.writeN, &acc.stats.MaxWriteLag)
+				observeLag(flushLag, &acc.flushSum, &acc.flushN, &acc.stats.MaxFlushLag)
+				observeLag(replayLag, &acc.replSum, &acc.replN, &acc.stats.MaxReplayLag)
+				if replayBytes.Valid && int64(replayBytes.Float64) > acc.stats.MaxReplayBytes {
+					acc.stats.MaxReplayBytes = int64(replayBytes.Float64)
+				}
+			}
+			rows.Close()
+		}
+
+		select {
+		case <-stop:
+			result := make([]WALSenderStats, 0, len(order))
+			for _, key := range order {
+				acc := senders[key]
+				if acc.writeN > 0 {
+					acc.stats.AvgWriteLag = acc.writeSum / time.Duration(acc.writeN)
+				}
+				if acc.flushN > 0 {
+					acc.stats.AvgFlushLag = acc.flushSum / time.Duration(acc.flushN)
+				}
+				if acc.replN > 0 {
+					acc.stats.AvgReplayLag = acc.replSum / time.Duration(acc.replN)
+				}
+				result = append(result, acc.stats)
+			}
+			return result
+		case <-ticker.C:
+		}
+	}
+}
+
+// observeLag adds one pg_stat_replication lag column to a running sum and max
+func observeLag(seconds sql.NullFloat64, sum *time.Duration, n *int, max *time.Duration) {
+	if !seconds.Valid {
+		return
+	}
+	lag := time.Duration(seconds.Float64 * float64(time.Second))
+	*sum += lag
+	*n++
+	if lag > *max {
+		*max = lag
+	}
+}
+
+func newLagStats(testCount, failed int, lags []time.Duration) LagStats {
+	stats := LagStats{
+		TestCount:    testCount,
+		SuccessCount: len(lags),
+		FailedCount:  failed,
+		AllLags:      lags,
+	}
+	if len(lags) == 0 {
+		return stats
+	}
+
+	var totalLag time.Duration
+	for _, lag := range lags {
+		totalLag += lag
+	}
+	stats.AvgLag = totalLag / time.Duration(len(lags))
+
+	// Sort for percentiles
+	sortedLags := make([]time.Duration, len(lags))
+	copy(sortedLags, lags)
+	sortDurations(sortedLags)
+
+	stats.MinLag = sortedLags[0]
+	stats.MaxLag = sortedLags[len(sortedLags)-1]
+	stats.P50Lag = sortedLags[len(sortedLags)*50/100]
+	stats.P95Lag = sortedLags[len(sortedLags)*95/100]
+	stats.P99Lag = sortedLags[len(sortedLags)*99/100]
+	return stats
+}
+
+func sortDurations(d []time.Duration) {
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+}
+
+func printReplicationReport(result ReplicationResult) {
+	printSection("Replication Lag Report")
+	fmt.Println()
+
+	if len(result.Replicas) > 1 {
+		fmt.Println("   Lag until a write is visible on ALL replicas:")
+		fmt.Println()
+	}
+	printLagStats(result.LagStats)
+
+	if len(result.Replicas) > 1 {
+		fmt.Println()
+		fmt.Println("   Visibility lag per replica:")
+		printReplicaLagTable(result.Replicas, func(r ReplicaLagResult) LagStats { return r.LagStats })
+	}
+
+	fmt.Println()
+	fmt.Println("   LSN replay lag (until pg_last_wal_replay_lsn() passes the write):")
+	printReplicaLagTable(result.Replicas, func(r ReplicaLagResult) LagStats { return r.LSNLag })
+
+	if len(result.WALSenders) > 0 {
+		fmt.Println()
+		fmt.Println("   pg_stat_replication on PRIMARY (avg / max):")
+		fmt.Println("   ┌──────────────────────┬───────────┬─────────────────────┬─────────────────────┬─────────────────────┬─────────────┐")
+		fmt.Printf("   │ %-20s │ %-9s │ %-19s │ %-19s │ %-19s │ %-11s │\n", "Standby", "State", "Write Lag", "Flush Lag", "Replay Lag", "Max Behind")
+		fmt.Println("   ├──────────────────────┼───────────┼─────────────────────┼─────────────────────┼─────────────────────┼─────────────┤")
+		for _, w := range result.WALSenders {
+			name := w.ApplicationName
+			if name == "" {
+				name = w.ClientAddr
+			}
+			if len(name) > 20 {
+				name = name[:17] + "..."
+			}
+			fmt.Printf("   │ %-20s │ %-9s │ %-19s │ %-19s │ %-19s │ %-11s │\n", name, w.State,
+				formatLagPair(w.AvgWriteLag, w.MaxWriteLag), formatLagPair(w.AvgFlushLag, w.MaxFlushLag),
+				formatLagPair(w.AvgReplayLag, w.MaxReplayLag), formatBytes(w.MaxReplayBytes))
+		}
+		fmt.Println("   └──────────────────────┴───────────┴─────────────────────┴─────────────────────┴─────────────────────┴─────────────┘")
+	}
+
+	// Performance assessment
+	fmt.Println()
+	if result.AvgLag < 10*time.Millisecond {
+		fmt.Println("   [EXCELLENT] Replication is very fast! Avg lag < 10ms")
+	} else if result.AvgLag < 100*time.Millisecond {
+		fmt.Println("   [GOOD] Replication is healthy. Avg lag < 100ms")
+	} else if result.AvgLag < 1*time.Second {
+		fmt.Println("   [WARNING] Replication lag is noticeable. Avg lag < 1s")
+	} else {
+		fmt.Println("   [CRITICAL] Replication lag is high! Avg lag > 1s")
+	}
+}
+
+func printReplicaLagTable(replicas []ReplicaLagResult, stats func(ReplicaLagResult) LagStats) {
+	fmt.Println("   ┌──────────────────┬───────────┬───────────┬───────────┬───────────┬───────────┐")
+	fmt.Printf("   │ %-16s │ %-9s │ %-9s │ %-9s │ %-9s │ %-9s │\n", "Replica", "Avg Lag", "P50 Lag", "P95 Lag", "P99 Lag", "Success%")
+	fmt.Println("   ├──────────────────┼───────────┼───────────┼───────────┼───────────┼───────────┤")
+	for _, r := range replicas {
+		s := stats(r)
+		successRate := 0.0
+		if s.TestCount > 0 {
+			successRate = float64(s.SuccessCount) / float64(s.TestCount) * 100
+		}
+		fmt.Printf("   │ %-16s │ %9s │ %9s │ %9s │ %9s │ %8.1f%% │\n", r.Name,
+			s.AvgLag.Round(time.Microsecond).String(), s.P50Lag.Round(time.Microsecond).String(),
+			s.P95Lag.Round(time.Microsecond).String(), s.P99Lag.Round(time.Microsecond).String(), successRate)
+	}
+	fmt.Println("   └──────────────────┴───────────┴───────────┴───────────┴───────────┴───────────┘")
+}
+
+func formatLagPair(avg, max time.Duration) string {
+	return fmt.Sprintf("%v / %v", avg.Round(100*time.Microsecond), max.Round(100*time.Microsecond))
+}
+
+func formatBytes(b int64) string {
+	switch {
+	case b >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(b)/(1<<30))
+	case b >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(b)/(1<<20))
+	case b >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(b)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", b)
+}
+
+func printLagStats(stats LagStats) {
+	successRate := float64(stats.SuccessCount) / float64(stats.TestCount) * 100
+
+	fmt.Println("   ┌─────────────────────────────────────────────────────────────────┐")
+	fmt.Printf("   │ %-30s %-33d │\n", "Total Tests:", stats.TestCount)
+	fmt.Printf("   │ %-30s %-33d │\n", "Successful:", stats.SuccessCount)
+	fmt.Printf("   │ %-30s %-33d │\n", "Failed/Timeout:", stats.FailedCount)
+	fmt.Printf("   │ %-30s %-32.1f%% │\n", "Success Rate:", successRate)
+	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
+	fmt.Printf("   │ %-30s %-33s │\n", "Average Replication Lag:", stats.AvgLag.Round(time.Microsecond))
+	fmt.Printf("   │ %-30s %-33s │\n", "Minimum Replication Lag:", stats.MinLag.Round(time.Microsecond))
+	fmt.Printf("   │ %-30s %-33s │\n", "Maximum Replication Lag:", stats.MaxLag.Round(time.Microsecond))
+	fmt.Println("   ├─────────────────────────────────────────────────────────────────┤")
+	fmt.Printf("   │ %-30s %-33s │\n", "P50 (Median) Lag:", stats.P50Lag.Round(time.Microsecond))
+	fmt.Printf("   │ %-30s %-33s │\n", "P95 Lag:", stats.P95Lag.Round(time.Microsecond))
+	fmt.Printf("   │ %-30s %-33s │\n", "P99 Lag:", stats.P99Lag.Round(time.Microsecond))
+	fmt.Println("   └─────────────────────────────────────────────────────────────────┘")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const toolVersion = "1.1.0"
+
+// Report is the machine-readable record of a run, written as JSON
+type Report struct {
+	ToolVersion string              `json:"tool_version"`
+	Command     string              `json:"command"`
+	Scenario    string              `json:"scenario,omitempty"`
+	Schema      string              `json:"schema,omitempty"`
+	Seed        *SeedOptions        `json:"seed,omitempty"`
+	Dataset     string              `json:"dataset_fingerprint,omitempty"`
+	RandomSeed  int64               `json:"random_seed,omitempty"`
+	StartedAt   time.Time           `json:"started_at"`
+	FinishedAt  time.Time           `json:"finished_at"`
+	Passed      bool                `json:"passed"`
+	Databases   []DatabaseInfo      `json:"databases"`
+	Tests       []TestResult        `json:"tests"`
+	Capacity    []CapacityResult    `json:"capacity,omitempty"`
+	Replication *ReplicationResult  `json:"replication,omitempty"`
+	Baseline    *BaselineComparison `json:"baseline,omitempty"`
+	Failover    *FailoverResult     `json:"failover,omitempty"`
+}
+
+func newReport(command string) *Report {
+	return &Report{
+		ToolVersion: toolVersion,
+		Command:     command,
+		StartedAt:   time.Now(),
+		Tests:       []TestResult{},
+	}
+}
+
+// reportOutput is where a RESULTS_FILE of "-" is written. It is the real stdout;
+// the human-readable output is moved to stderr so the two do not mix.
+var reportOutput io.Writer = os.Stdout
+
+// writeReport writes the report as indented JSON to path, or to stdout if path is "-"
+func writeReport(path string, report *Report) error {
+	report.FinishedAt = time.Now()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = reportOutput.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// saveReport writes the report if a results file is configured and logs the
+// outcome. The commands finish their cleanup and then exit with exitError if it
+// failed, so a pipeline never reads a missing or stale results file.
+func saveReport(cfg Config, report *Report) error {
+	if cfg.ResultsFile == "" {
+		return nil
+	}
+	if err := writeReport(cfg.ResultsFile, report); err != nil {
+		logError("Failed to save JSON results", err)
+		return err
+	}
+	if cfg.ResultsFile != "-" {
+		logSuccess("JSON results written to " + cfg.ResultsFile)
+	}
+	return nil
+}
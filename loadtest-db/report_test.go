@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteReportRoundTrip(t *testing.T) {
+	h := NewHistogram()
+	h.Record(3 * time.Millisecond)
+	report := newReport("run")
+	report.Scenario = "default"
+	report.RandomSeed = 42
+	report.Passed = true
+	report.Tests = append(report.Tests, TestResult{
+		Name: "Reads", TotalOps: 10, SuccessOps: 9, FailedOps: 1, OpsPerSecond: 12.5,
+		P99Latency: 3 * time.Millisecond, Latency: h, Violations: []string{"P99 3ms > 1ms"},
+	})
+
+	path := filepath.Join(t.TempDir(), "results.json")
+	if err := writeReport(path, report); err != nil {
+		t.Fatalf("writeReport: %v", err)
+	}
+	got, err := loadBaseline(path)
+	if err != nil {
+		t.Fatalf("loadBaseline: %v", err)
+	}
+
+	if got.ToolVersion != toolVersion || got.Command != "run" || got.Scenario != "default" || got.RandomSeed != 42 || !got.Passed {
+		t.Errorf("report header = %+v", got)
+	}
+	if got.FinishedAt.IsZero() || got.FinishedAt.Before(got.StartedAt) {
+		t.Errorf("finished_at %v, started_at %v", got.FinishedAt, got.StartedAt)
+	}
+	if len(got.Tests) != 1 {
+		t.Fatalf("%d tests, want 1", len(got.Tests))
+	}
+	r := got.Tests[0]
+	if r.Name != "Reads" || r.TotalOps != 10 || r.FailedOps != 1 || r.OpsPerSecond != 12.5 || r.P99Latency != 3*time.Millisecond {
+		t.Errorf("test result = %+v", r)
+	}
+	if r.Latency == nil || r.Latency.Count() != 1 {
+		t.Errorf("latency histogram = %+v, want one sample", r.Latency)
+	}
+	if len(r.Violations) != 1 {
+		t.Errorf("violations = %q", r.Violations)
+	}
+}
+
+func TestWriteReportToStdout(t *testing.T) {
+	var buf bytes.Buffer
+	old := reportOutput
+	reportOutput = &buf
+	defer func() { reportOutput = old }()
+
+	if err := writeReport("-", newReport("failover")); err != nil {
+		t.Fatalf("writeReport: %v", err)
+	}
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("stdout is not a JSON report: %v\n%s", err, buf.String())
+	}
+	if got.Command != "failover" {
+		t.Errorf("command = %q, want failover", got.Command)
+	}
+}
+
+func TestSaveReport(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		path string
+		ok   bool
+	}{
+		{"no results file", "", true},
+		{"results file", filepath.Join(dir, "results.json"), true},
+		{"missing directory", filepath.Join(dir, "missing", "results.json"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := saveReport(Config{ResultsFile: tt.path}, newReport("run"))
+			if (err == nil) != tt.ok {
+				t.Errorf("saveReport(%q) = %v, want ok = %v", tt.path, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Commands that create or drop objects only run against a database that opted
+// in, so a DB_HOST pointing at production by mistake is left alone. The opt-in
+// is one of:
+//
+//	ALLOW_DESTRUCTIVE=true (or -allow-destructive)
+//	ALTER DATABASE mydb SET loadtest.allow = on;
+//	COMMENT ON DATABASE mydb IS '... loadtest:allow ...';
+
+// optInComment marks a database as a load test target in its comment
+const optInComment = "loadtest:allow"
+
+// readOnlyMode is set by 'run -read-only': every session is opened with
+// default_transaction_read_only and nothing is created or dropped
+var readOnlyMode bool
+
+// checkDestructiveAllowed returns how db opted in to having load test objects
+// created and dropped, or an error if it did not
+func checkDestructiveAllowed(db *sql.DB, cfg Config) (string, error) {
+	if readOnlyMode {
+		return "", fmt.Errorf("read-only mode does not create or drop objects")
+	}
+	if cfg.AllowDestructive {
+		return "ALLOW_DESTRUCTIVE", nil
+	}
+
+	var setting, comment sql.NullString
+	var dbname string
+	err := db.QueryRow(`SELECT current_setting('loadtest.allow', true), shobj_description(oid, 'pg_database'), datname
+		FROM pg_database WHERE datname = current_database()`).Scan(&setting, &comment, &dbname)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the opt-in marker: %w", err)
+	}
+	switch strings.ToLower(setting.String) {
+	case "on", "true", "yes", "1":
+		return "loadtest.allow = " + setting.String, nil
+	}
+	if strings.Contains(comment.String, optInComment) {
+		return "database comment", nil
+	}
+
+	return "", fmt.Errorf("database %q has not opted in to load tests that create and drop tables; "+
+		"set ALLOW_DESTRUCTIVE=true (-allow-destructive), run ALTER DATABASE %s SET loadtest.allow = on, "+
+		"or add %q to COMMENT ON DATABASE; use -read-only to run only read workloads",
+		dbname, pq.QuoteIdentifier(dbname), optInComment)
+}
+
+// checkCollisions refuses to use schema if it or the run registry exists but
+// does not belong to the load test. Anything in a load test schema that is not
+// a load test object would be lost by DROP SCHEMA ... CASCADE.
+func checkCollisions(db *sql.DB, schema string) error {
+	var registry, registered, exists bool
+	err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL, EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $2)`,
+		runRegistry, schema).Scan(&registry, &exists)
+	if err != nil {
+		return err
+	}
+
+	if registry {
+		var columns int
+		err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = 'public' AND table_name = 'loadtest_runs'
+			  AND column_name IN ('schema_name', 'command', 'heartbeat_at', 'keep')`).Scan(&columns)
+		if err != nil {
+			return err
+		}
+		if columns != 4 {
+			return fmt.Errorf("%s exists but is not a load test run registry", runRegistry)
+		}
+		if exists {
+			if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+runRegistry+` WHERE schema_name = $1)`, schema).Scan(&registered); err != nil {
+				return err
+			}
+		}
+	}
+	if !exists {
+		return nil
+	}
+	if !registered {
+		return fmt.Errorf("schema %s exists but was not created by the load test", schema)
+	}
+
+	foreign, err := foreignObjects(db, schema)
+	if err != nil {
+		return err
+	}
+	if len(foreign) > 0 {
+		return fmt.Errorf("schema %s contains objects that are not load test objects: %s", schema, strings.Join(foreign, ", "))
+	}
+	return nil
+}
+
+// foreignObjects lists the relations and functions in schema whose names the
+// load test does not use
+func foreignObjects(db *sql.DB, schema string) ([]string, error) {
+	rows, err := db.Query(`SELECT relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND relname NOT LIKE 'loadtest\_%' AND relname NOT LIKE 'idx\_loadtest\_%'
+		UNION ALL
+		SELECT proname || '()' FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE n.nspname = $1
+		ORDER BY 1`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// readOnlyWorkload is implemented by workloads that can tell whether they write
+type readOnlyWorkload interface {
+	ReadOnly(params WorkloadParams) bool
+}
+
+// isReadOnly reports whether a workload never writes with the given params.
+// Workloads that cannot tell count as writing.
+func isReadOnly(w Workload, params WorkloadParams) bool {
+	r, ok := w.(readOnlyWorkload)
+	return ok && r.ReadOnly(params.withDefaults(w.Defaults()))
+}
+
+// writeKeywords mark a statement as one that can write, including SELECT INTO,
+// SELECT ... FOR UPDATE and sequence functions
+var writeKeywords = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE|UPSERT|TRUNCATE|CREATE|DROP|ALTER|GRANT|REVOKE|COPY|INTO|LOCK|VACUUM|ANALYZE|CLUSTER|REINDEX|REFRESH|CALL|DO|NEXTVAL|SETVAL)\b`)
+
+// isReadOnlySQL is a conservative check that stmt only reads. The server
+// enforces it too: read-only sessions reject writes that slip through.
+func isReadOnlySQL(stmt string) bool {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return true
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "VALUES", "TABLE", "SHOW", "EXPLAIN":
+		return !writeKeywords.MatchString(stmt)
+	}
+	return false
+}
+
+// readOnlySessionParam makes every transaction of a read-only run read-only
+func readOnlySessionParam() string {
+	if !readOnlyMode {
+		return ""
+	}
+	return " default_transaction_read_only=on"
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestCheckCollisions(t *testing.T) {
+	const schema = "loadtest_20250102_150405_3fa9"
+	catalog := func(registry, exists bool) fakeAnswer {
+		return fakeAnswer{match: "to_regclass($1) IS NOT NULL, EXISTS", rows: [][]driver.Value{{registry, exists}}}
+	}
+	registryColumns := func(n int64) fakeAnswer {
+		return fakeAnswer{match: "information_schema.columns", rows: [][]driver.Value{{n}}}
+	}
+	registered := func(ok bool) fakeAnswer {
+		return fakeAnswer{match: "FROM " + runRegistry + " WHERE schema_name", rows: [][]driver.Value{{ok}}}
+	}
+	foreign := func(names ...string) fakeAnswer {
+		var rows [][]driver.Value
+		for _, n := range names {
+			rows = append(rows, []driver.Value{n})
+		}
+		return fakeAnswer{match: "FROM pg_class", rows: rows}
+	}
+
+	tests := []struct {
+		name    string
+		answers []fakeAnswer
+		ok      bool
+	}{
+		{"new cluster", []fakeAnswer{catalog(false, false)}, true},
+		{"new schema", []fakeAnswer{catalog(true, false), registryColumns(4)}, true},
+		{"schema without a registry", []fakeAnswer{catalog(false, true)}, false},
+		{"foreign registry table", []fakeAnswer{catalog(true, false), registryColumns(2)}, false},
+		{"unregistered schema", []fakeAnswer{catalog(true, true), registryColumns(4), registered(false)}, false},
+		{"registered schema", []fakeAnswer{catalog(true, true), registryColumns(4), registered(true), foreign()}, true},
+		{"foreign objects", []fakeAnswer{catalog(true, true), registryColumns(4), registered(true), foreign("customers", "audit()")}, false},
+		{"catalog error", []fakeAnswer{{match: "to_regclass", err: errors.New("connection reset")}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, tt.answers...)
+			if err := checkCollisions(db, schema); (err == nil) != tt.ok {
+				t.Errorf("checkCollisions() = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsReadOnlySQL(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want bool
+	}{
+		{"", true},
+		{"SELECT 1", true},
+		{"  select * from loadtest_simple where id = $1", true},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true},
+		{"VALUES (1), (2)", true},
+		{"TABLE loadtest_simple", true},
+		{"SHOW server_version", true},
+		{"EXPLAIN SELECT 1", true},
+		{"SELECT data FROM loadtest_simple WHERE updated = false", true}, // "updated" is not UPDATE
+		{"INSERT INTO t VALUES (1)", false},
+		{"update t set x = 1", false},
+		{"DELETE FROM t", false},
+		{"SELECT * INTO copy_of_t FROM t", false},
+		{"SELECT * FROM t FOR UPDATE", false},
+		{"SELECT nextval('s')", false},
+		{"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d", false},
+		{"EXPLAIN ANALYZE DELETE FROM t", false},
+		{"CALL refresh()", false},
+		{"SET search_path = x", false},
+		{"BEGIN", false},
+	}
+	for _, tt := range tests {
+		if got := isReadOnlySQL(tt.stmt); got != tt.want {
+			t.Errorf("isReadOnlySQL(%q) = %v, want %v", tt.stmt, got, tt.want)
+		}
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		workload string
+		want     bool
+	}{
+		{"simple_read", true},
+		{"time_range_query", true},
+		{"aggregation", true},
+		{"simple_write", false},
+		{"mixed", false},
+		{"read_your_writes", false},
+	}
+	for _, tt := range tests {
+		if got := isReadOnly(workloads[tt.workload], WorkloadParams{}); got != tt.want {
+			t.Errorf("isReadOnly(%s) = %v, want %v", tt.workload, got, tt.want)
+		}
+	}
+}
+
+func TestUsesTestTables(t *testing.T) {
+	tests := []struct {
+		name      string
+		workloads []string
+		want      bool
+	}{
+		{"built-in reads", []string{"simple_read", "aggregation"}, true},
+		{"scripts only", []string{"sql_script", "replay"}, false},
+		{"scripts and a built-in read", []string{"replay", "time_range_query"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scenario{}
+			for _, w := range tt.workloads {
+				s.Tests = append(s.Tests, ScenarioTest{Name: w, Workload: w})
+			}
+			if got := s.usesTestTables(); got != tt.want {
+				t.Errorf("usesTestTables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed scenarios/default.json
+var defaultScenarioJSON []byte
+
+// Test targets a scenario test can run against
+const (
+	TargetPrimary = "primary"
+	TargetReplica = "replica"
+	TargetProxy   = "proxy"
+)
+
+// Duration is a time.Duration that reads from JSON strings such as "10s" or "1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Scenario is an ordered list of load tests
+type Scenario struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Tests       []ScenarioTest `json:"tests"`
+
+	// Assert applies to every test without its own assertions
+	Assert            *Assertions            `json:"assert,omitempty"`
+	ReplicationAssert *ReplicationAssertions `json:"replication_assert,omitempty"`
+}
+
+// ScenarioTest describes a single load test in a scenario
+type ScenarioTest struct {
+	Name         string   `json:"name"`
+	Workload     string   `json:"workload"`
+	Target       string   `json:"target,omitempty"`
+	Concurrency  int      `json:"concurrency"`
+	OpsPerWorker int      `json:"ops_per_worker"`
+	Duration     Duration `json:"duration"`
+	Rate         float64  `json:"rate,omitempty"`
+	RampUp       Duration `json:"ramp_up,omitempty"`
+	RampDown     Duration `json:"ramp_down,omitempty"`
+	Order        int      `json:"order,omitempty"`
+
+	// Params tune the workload; unset fields take the workload's defaults
+	Params WorkloadParams `json:"params,omitempty"`
+
+	// Search, if set, turns the test into a step-load capacity search
+	Search *CapacitySearch `json:"search,omitempty"`
+
+	// Assert overrides the scenario-wide assertions for this test
+	Assert *Assertions `json:"assert,omitempty"`
+}
+
+// loadScenario reads the scenario from path, or the built-in default scenario if path is empty
+func loadScenario(path string) (*Scenario, error) {
+	data := defaultScenarioJSON
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scenario file: %w", err)
+		}
+		data = b
+	}
+
+	var s Scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %q: %w", path, err)
+	}
+
+	// Script and replay files in a scenario file are relative to that file
+	if path != "" {
+		for i := range s.Tests {
+			s.Tests[i].Params.resolvePaths(filepath.Dir(path))
+		}
+	}
+	// Replay tests without a concurrency take the one of the captured traffic
+	for i := range s.Tests {
+		if err := s.Tests[i].replayConcurrency(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.setDefaults()
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	// Capacity searches push the load until it breaks, so SLOs do not apply to them
+	if s.Assert != nil {
+		for i := range s.Tests {
+			if s.Tests[i].Assert == nil && s.Tests[i].Search == nil {
+				s.Tests[i].Assert = s.Assert
+			}
+		}
+	}
+
+	// Tests without an explicit order keep their position in the file
+	sort.SliceStable(s.Tests, func(i, j int) bool {
+		return s.Tests[i].Order < s.Tests[j].Order
+	})
+
+	return &s, nil
+}
+
+// setDefaults names unnamed tests after their workload, points tests without a
+// target at the primary and starts capacity searches, by concurrency unless
+// set, at their first step
+func (s *Scenario) setDefaults() {
+	for i := range s.Tests {
+		t := &s.Tests[i]
+		if t.Name == "" {
+			t.Name = t.Workload
+		}
+		if t.Target == "" {
+			t.Target = TargetPrimary
+		}
+		// A capacity search sets concurrency or rate itself for every step
+		if t.Search != nil && t.Search.Mode == "" {
+			t.Search.Mode = SearchConcurrency
+		}
+		if t.Search != nil && t.Search.Mode == SearchConcurrency {
+			t.Concurrency = int(t.Search.Start)
+		}
+	}
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Tests) == 0 {
+		return fmt.Errorf("scenario %q has no tests", s.Name)
+	}
+
+	for i := range s.Tests {
+		t := &s.Tests[i]
+		if _, ok := workloads[t.Workload]; !ok {
+			return fmt.Errorf("test %q: unknown workload %q", t.Name, t.Workload)
+		}
+		if err := t.Params.validate(); err != nil {
+			return fmt.Errorf("test %q: %w", t.Name, err)
+		}
+		if !isTarget(t.Target) {
+			return fmt.Errorf("test %q: unknown target %q (use primary, replica, replica-N or proxy)", t.Name, t.Target)
+		}
+
+		openLoop := t.Rate > 0
+		if t.Search != nil {
+			if err := t.Search.validate(); err != nil {
+				return fmt.Errorf("test %q: %w", t.Name, err)
+			}
+			openLoop = t.Search.Mode != SearchConcurrency
+		}
+
+		if t.Concurrency <= 0 {
+			return fmt.Errorf("test %q: concurrency must be positive", t.Name)
+		}
+		if t.Rate < 0 {
+			return fmt.Errorf("test %q: rate must not be negative", t.Name)
+		}
+		// Open-loop tests may omit ops_per_worker and run for the full duration
+		if t.OpsPerWorker < 0 || (t.OpsPerWorker == 0 && !openLoop) {
+			return fmt.Errorf("test %q: ops_per_worker must be positive", t.Name)
+		}
+		if t.Duration <= 0 {
+			return fmt.Errorf("test %q: duration must be positive", t.Name)
+		}
+		if t.RampUp < 0 || t.RampDown < 0 {
+			return fmt.Errorf("test %q: ramp_up and ramp_down must not be negative", t.Name)
+		}
+	}
+	return nil
+}
+
+// applySeed points the tests that pick seeded rows and leave key_range unset, and
+// the read tests that leave devices unset, at the whole seeded dataset, so a
+// larger seed also spreads the reads and updates over it. An empty dataset
+// leaves such tests no keys to pick.
+func (s *Scenario) applySeed(seed SeedOptions) error {
+	for i := range s.Tests {
+		t := &s.Tests[i]
+		w := workloads[t.Workload]
+		if t.Params.KeyRange == 0 && w.Defaults().KeyRange > 0 {
+			if seed.Rows <= 0 {
+				return fmt.Errorf("test %q picks seeded rows but SEED_ROWS is %d; set key_range or seed rows", t.Name, seed.Rows)
+			}
+			t.Params.KeyRange = seed.Rows
+		}
+		if !isReadOnly(w, t.Params) {
+			continue
+		}
+		if t.Params.Devices == 0 {
+			if seed.Devices <= 0 {
+				return fmt.Errorf("test %q picks seeded devices but SEED_DEVICES is %d; set devices or seed devices", t.Name, seed.Devices)
+			}
+			t.Params.Devices = seed.Devices
+		}
+	}
+	return nil
+}
+
+// applyDataEnd ends the time windows of the read tests at the end of the seeded
+// time series, so a kept dataset is queried the same way however old it is and
+// rows written by earlier runs stay out of the windows
+func (s *Scenario) applyDataEnd(end time.Time) {
+	for i := range s.Tests {
+		s.Tests[i].Params.DataEnd = end
+	}
+}
+
+// isTarget reports whether target is primary, proxy, replica (the first replica)
+// or replica-N
+func isTarget(target string) bool {
+	switch target {
+	case TargetPrimary, TargetReplica, TargetProxy:
+		return true
+	}
+	n, ok := strings.CutPrefix(target, TargetReplica+"-")
+	if !ok {
+		return false
+	}
+	i, err := strconv.Atoi(n)
+	return err == nil && i > 0
+}
+
+// usesReplica reports whether any test in the scenario runs against a replica
+func (s *Scenario) usesReplica() bool {
+	for _, t := range s.Tests {
+		if t.Target == TargetReplica || strings.HasPrefix(t.Target, TargetReplica+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// usesTestTables reports whether any test runs a built-in workload, which needs
+// the loadtest_* tables
+func (s *Scenario) usesTestTables() bool {
+	for _, t := range s.Tests {
+		if _, ok := workloads[t.Workload].(funcWorkload); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// usesTarget reports whether any test in the scenario runs against target
+func (s *Scenario) usesTarget(target string) bool {
+	for _, t := range s.Tests {
+		if t.Target == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaultScenario(t *testing.T) {
+	s, err := loadScenario("")
+	if err != nil {
+		t.Fatalf("loadScenario: %v", err)
+	}
+	if len(s.Tests) == 0 {
+		t.Fatal("default scenario has no tests")
+	}
+	for _, test := range s.Tests {
+		if test.Name == "" || test.Target == "" {
+			t.Errorf("test %+v: name and target must be set", test)
+		}
+	}
+}
+
+func TestLoadScenarioFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scenario.json")
+	data := `{
+		"name": "file",
+		"assert": {"max_p99": "50ms"},
+		"tests": [
+			{"workload": "simple_write", "concurrency": 2, "ops_per_worker": 5, "duration": "1s", "order": 2},
+			{"name": "Reads", "workload": "simple_read", "target": "replica", "concurrency": 1, "ops_per_worker": 1, "duration": "2s", "order": 1,
+			 "assert": {"min_ops_per_sec": 10}},
+			{"name": "Knee", "workload": "simple_read", "duration": "1s", "ops_per_worker": 1, "order": 1,
+			 "search": {"start": 4, "step": 4, "max": 16, "max_p99": "10ms"}}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadScenario(path)
+	if err != nil {
+		t.Fatalf("loadScenario: %v", err)
+	}
+
+	var names []string
+	for _, test := range s.Tests {
+		names = append(names, test.Name)
+	}
+	if want := []string{"Reads", "Knee", "simple_write"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("tests = %q, want %q", names, want)
+	}
+
+	reads, knee, writes := s.Tests[0], s.Tests[1], s.Tests[2]
+	if reads.Target != TargetReplica || time.Duration(reads.Duration) != 2*time.Second {
+		t.Errorf("Reads: target %q, duration %v", reads.Target, time.Duration(reads.Duration))
+	}
+	if reads.Assert == nil || reads.Assert.MinOpsPerSec != 10 || reads.Assert.MaxP99 != 0 {
+		t.Errorf("Reads: assert = %+v, want its own", reads.Assert)
+	}
+	if writes.Target != TargetPrimary {
+		t.Errorf("unnamed test: target = %q, want %q", writes.Target, TargetPrimary)
+	}
+	if writes.Assert == nil || time.Duration(writes.Assert.MaxP99) != 50*time.Millisecond {
+		t.Errorf("unnamed test: assert = %+v, want the scenario's", writes.Assert)
+	}
+	if knee.Assert != nil {
+		t.Errorf("Knee: capacity search took assertions %+v", knee.Assert)
+	}
+	if knee.Search.Mode != SearchConcurrency || knee.Concurrency != 4 {
+		t.Errorf("Knee: mode %q, concurrency %d, want %q from 4", knee.Search.Mode, knee.Concurrency, SearchConcurrency)
+	}
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not JSON", `{"tests": [`},
+		{"duration not a string", `{"tests": [{"workload": "simple_read", "concurrency": 1, "ops_per_worker": 1, "duration": 5}]}`},
+		{"bad duration", `{"tests": [{"workload": "simple_read", "concurrency": 1, "ops_per_worker": 1, "duration": "5 seconds"}]}`},
+		{"no tests", `{"name": "empty", "tests": []}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadScenario(path); err == nil {
+				t.Errorf("loadScenario(%s) succeeded, want an error", tt.data)
+			}
+		})
+	}
+	if _, err := loadScenario(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loadScenario of a missing file succeeded, want an error")
+	}
+}
+
+func TestScenarioSetDefaults(t *testing.T) {
+	s := &Scenario{Tests: []ScenarioTest{
+		{Workload: "simple_read"},
+		{Name: "Named", Workload: "simple_read", Target: TargetProxy},
+		{Workload: "simple_read", Concurrency: 3, Search: &CapacitySearch{Start: 8}},
+		{Workload: "simple_read", Concurrency: 3, Search: &CapacitySearch{Mode: SearchRate, Start: 8}},
+	}}
+	s.setDefaults()
+
+	tests := []struct {
+		name, target, mode string
+		concurrency        int
+	}{
+		{"simple_read", TargetPrimary, "", 0},
+		{"Named", TargetProxy, "", 0},
+		{"simple_read", TargetPrimary, SearchConcurrency, 8},
+		{"simple_read", TargetPrimary, SearchRate, 3},
+	}
+	for i, want := range tests {
+		got := s.Tests[i]
+		mode := ""
+		if got.Search != nil {
+			mode = got.Search.Mode
+		}
+		if got.Name != want.name || got.Target != want.target || mode != want.mode || got.Concurrency != want.concurrency {
+			t.Errorf("test %d: name %q, target %q, mode %q, concurrency %d; want %q, %q, %q, %d",
+				i, got.Name, got.Target, mode, got.Concurrency, want.name, want.target, want.mode, want.concurrency)
+		}
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	valid := ScenarioTest{Name: "t", Workload: "simple_read", Target: TargetPrimary, Concurrency: 1, OpsPerWorker: 1, Duration: Duration(time.Second)}
+	search := &CapacitySearch{Mode: SearchRate, Start: 10, Step: 10, Max: 100, MaxErrorRate: 1}
+
+	tests := []struct {
+		name   string
+		modify func(t *ScenarioTest)
+		ok     bool
+	}{
+		{"valid", func(t *ScenarioTest) {}, true},
+		{"replica-N target", func(t *ScenarioTest) { t.Target = "replica-2" }, true},
+		{"unknown workload", func(t *ScenarioTest) { t.Workload = "nope" }, false},
+		{"unknown target", func(t *ScenarioTest) { t.Target = "standby" }, false},
+		{"bad params", func(t *ScenarioTest) { t.Params.KeyRange = -1 }, false},
+		{"no concurrency", func(t *ScenarioTest) { t.Concurrency = 0 }, false},
+		{"negative rate", func(t *ScenarioTest) { t.Rate = -1 }, false},
+		{"no ops per worker", func(t *ScenarioTest) { t.OpsPerWorker = 0 }, false},
+		{"open loop without ops per worker", func(t *ScenarioTest) { t.OpsPerWorker, t.Rate = 0, 50 }, true},
+		{"negative ops per worker", func(t *ScenarioTest) { t.OpsPerWorker, t.Rate = -1, 50 }, false},
+		{"no duration", func(t *ScenarioTest) { t.Duration = 0 }, false},
+		{"negative ramp", func(t *ScenarioTest) { t.RampDown = Duration(-time.Second) }, false},
+		{"rate search without ops per worker", func(t *ScenarioTest) { t.OpsPerWorker, t.Search = 0, search }, true},
+		{"search without a limit", func(t *ScenarioTest) { t.Search = &CapacitySearch{Mode: SearchRate, Start: 1, Step: 1, Max: 2} }, false},
+		{"unknown search mode", func(t *ScenarioTest) {
+			t.Search = &CapacitySearch{Mode: "workers", Start: 1, Step: 1, Max: 2, MaxErrorRate: 1}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := valid
+			tt.modify(&test)
+			s := &Scenario{Name: "s", Tests: []ScenarioTest{test}}
+			if err := s.validate(); (err == nil) != tt.ok {
+				t.Errorf("validate() = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+
+	if err := (&Scenario{Name: "empty"}).validate(); err == nil {
+		t.Error("validate() of a scenario without tests succeeded, want an error")
+	}
+}
@@ -0,0 +1,8 @@
+-- Recent readings of one device
+\set device device(100)
+\set since random_time(3600)
+SELECT time, temperature, humidity, pressure
+FROM loadtest_timeseries
+WHERE device_id = :device AND time >= :since
+ORDER BY time DESC
+LIMIT 50;
@@ -0,0 +1,7 @@
+-- Bump a counter and read it back in one transaction
+\set id random(1, 1000)
+\set delta random(-5, 5)
+BEGIN;
+UPDATE loadtest_simple SET value = value + :delta WHERE id = :id;
+SELECT value FROM loadtest_simple WHERE id = :id;
+COMMIT;
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Every run creates its tables in a schema of its own, so concurrent runs
+// against the same cluster cannot drop each other's data. The schema is put in
+// front of the search_path of every connection, which keeps the table names in
+// the workloads unqualified.
+
+// runSchemaPrefix starts the name of every schema the load test creates
+const runSchemaPrefix = "loadtest_"
+
+// datasetSchema holds the kept dataset of -keep-data runs without -schema
+const datasetSchema = runSchemaPrefix + "dataset"
+
+// runHeartbeatInterval is how often a run marks itself alive in the registry
+const runHeartbeatInterval = 30 * time.Second
+
+// runRegistry records the schema of every run. The janitor drops the schemas of
+// runs whose heartbeat stopped.
+const runRegistry = "public.loadtest_runs"
+
+var schemaNamePattern = regexp.MustCompile(`^` + runSchemaPrefix + `[a-z0-9_]+$`)
+
+// newSchemaName returns a unique schema name for a run, e.g.
+// loadtest_20250102_150405_3fa9
+func newSchemaName() string {
+	return fmt.Sprintf("%s%s_%04x", runSchemaPrefix, time.Now().UTC().Format("20060102_150405"), rand.Intn(0x10000))
+}
+
+// validSchemaName rejects names that could be a schema the load test does not own
+func validSchemaName(name string) error {
+	if len(name) > 63 || !schemaNamePattern.MatchString(name) {
+		return fmt.Errorf("schema %q must match %s[a-z0-9_]+ and be at most 63 characters", name, runSchemaPrefix)
+	}
+	return nil
+}
+
+// resolveSchema returns the configured schema, the shared dataset schema when
+// data is kept, or a new one. owned reports whether the schema was generated
+// for this run.
+func resolveSchema(cfg Config) (schema string, owned bool, err error) {
+	if cfg.Schema == "" && cfg.KeepData {
+		return datasetSchema, false, nil
+	}
+	if cfg.Schema == "" {
+		return newSchemaName(), true, nil
+	}
+	return cfg.Schema, false, validSchemaName(cfg.Schema)
+}
+
+// testRun is a registered run whose heartbeat keeps the janitor away
+type testRun struct {
+	db     *sql.DB
+	schema string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// startRun creates schema if needed, registers it and starts the heartbeat.
+// Schemas left by 'setup' are kept: the janitor leaves them alone.
+func startRun(db *sql.DB, schema, command string, keep bool) (*testRun, error) {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS ` + runRegistry + ` (
+			schema_name TEXT PRIMARY KEY,
+			command TEXT NOT NULL,
+			client TEXT NOT NULL,
+			started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			keep BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`CREATE SCHEMA IF NOT EXISTS ` + pq.QuoteIdentifier(schema),
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			return nil, fmt.Errorf("failed to execute: %s - %w", q, err)
+		}
+	}
+
+	client, _ := os.Hostname()
+	client = fmt.Sprintf("%s pid %d", client, os.Getpid())
+	_, err := db.Exec(`INSERT INTO `+runRegistry+` (schema_name, command, client, keep) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (schema_name) DO UPDATE SET command = $2, client = $3, heartbeat_at = NOW(), keep = `+runRegistry+`.keep OR $4`,
+		schema, command, client, keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register run: %w", err)
+	}
+
+	r := &testRun{db: db, schema: schema, stop: make(chan struct{}), done: make(chan struct{})}
+	go r.heartbeat()
+	return r, nil
+}
+
+func (r *testRun) heartbeat() {
+	defer close(r.done)
+	ticker := time.NewTicker(runHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			// A missed beat only matters if the run stays silent for the janitor's max age
+			r.db.Exec(`UPDATE `+runRegistry+` SET heartbeat_at = NOW() WHERE schema_name = $1`, r.schema)
+		}
+	}
+}
+
+// finish stops the heartbeat, and with drop removes the schema and its registration
+func (r *testRun) finish(drop bool) error {
+	if r == nil {
+		return nil
+	}
+	close(r.stop)
+	<-r.done
+	if !drop {
+		return nil
+	}
+	return dropSchema(r.db, r.schema)
+}
+
+// dropSchema drops a load test schema with everything in it and removes it from the registry
+func dropSchema(db *sql.DB, schema string) error {
+	if err := validSchemaName(schema); err != nil {
+		return err
+	}
+	if err := checkCollisions(db, schema); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DROP SCHEMA IF EXISTS ` + pq.QuoteIdentifier(schema) + ` CASCADE`); err != nil {
+		return err
+	}
+	_, err := db.Exec(`DELETE FROM `+runRegistry+` WHERE schema_name = $1`, schema)
+	return err
+}
+
+// registeredRun is a row of the run registry
+type registeredRun struct {
+	Schema    string
+	Command   string
+	StartedAt time.Time
+	Silent    time.Duration // since the last heartbeat
+	Keep      bool
+}
+
+func listRuns(db *sql.DB) ([]registeredRun, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, runRegistry).Scan(&exists); err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT schema_name, command, started_at, EXTRACT(EPOCH FROM NOW() - heartbeat_at), keep
+		FROM ` + runRegistry + ` ORDER BY started_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []registeredRun
+	for rows.Next() {
+		var r registeredRun
+		var silent float64
+		if err := rows.Scan(&r.Schema, &r.Command, &r.StartedAt, &silent, &r.Keep); err != nil {
+			return nil, err
+		}
+		r.Silent = time.Duration(silent * float64(time.Second))
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// runJanitor drops the schemas of runs that have not sent a heartbeat for
+// maxAge. Schemas kept by 'setup' are only listed.
+func runJanitor(db *sql.DB, maxAge time.Duration, dryRun bool) error {
+	runs, err := listRuns(db)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		logInfo("Registry", "no load test runs registered")
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Println("   ┌──────────────────────────────────┬─────────────────┬──────────────┬─────────────┐")
+	fmt.Printf("   │ %-32s │ %-15s │ %-12s │ %-11s │\n", "Schema", "Command", "Silent For", "Action")
+	fmt.Println("   ├──────────────────────────────────┼─────────────────┼──────────────┼─────────────┤")
+	var stale []registeredRun
+	for _, r := range runs {
+		action := "running"
+		switch {
+		case r.Keep:
+			action = "kept"
+		case r.Silent > maxAge:
+			action = "drop"
+			if dryRun {
+				action = "would drop"
+			}
+			stale = append(stale, r)
+		}
+		fmt.Printf("   │ %-32s │ %-15s │ %12s │ %-11s │\n", r.Schema, r.Command, r.Silent.Round(time.Second), action)
+	}
+	fmt.Println("   └──────────────────────────────────┴─────────────────┴──────────────┴─────────────┘")
+	fmt.Println()
+
+	if dryRun {
+		logInfo("Dry Run", fmt.Sprintf("%d stale schemas left in place", len(stale)))
+		return nil
+	}
+	dropped := 0
+	for _, r := range stale {
+		if err := dropSchema(db, r.Schema); err != nil {
+			logError("Failed to drop "+r.Schema, err)
+			continue
+		}
+		dropped++
+	}
+	logSuccess(fmt.Sprintf("Dropped %d stale schemas (no heartbeat for %v)", dropped, maxAge))
+	return nil
+}
+
+// qualify prefixes a table name with the run schema
+func qualify(schema, table string) string {
+	return pq.QuoteIdentifier(schema) + "." + table
+}
+
+// searchPathParam is the connection parameter that puts schema first on the
+// search_path, ahead of public where extensions such as TimescaleDB live
+func searchPathParam(schema string) string {
+	if schema == "" {
+		return ""
+	}
+	return " search_path=" + schema + ",public"
+}
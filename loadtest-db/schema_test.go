@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestValidSchemaName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"loadtest_20250102_150405_3fa9", true},
+		{datasetSchema, true},
+		{"loadtest_ci_1", true},
+		{"public", false},
+		{"loadtest_", false},
+		{"loadtest", false},
+		{"LOADTEST_x", false},
+		{"loadtest_X", false},
+		{"loadtest_a-b", false},
+		{`loadtest_a"; DROP SCHEMA public; --`, false},
+		{"myapp_loadtest_x", false},
+		{"loadtest_" + strings.Repeat("x", 54), true},
+		{"loadtest_" + strings.Repeat("x", 55), false}, // 64 characters
+	}
+	for _, tt := range tests {
+		if err := validSchemaName(tt.name); (err == nil) != tt.ok {
+			t.Errorf("validSchemaName(%q) = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestNewSchemaNameIsValid(t *testing.T) {
+	name := newSchemaName()
+	if err := validSchemaName(name); err != nil {
+		t.Errorf("newSchemaName() = %q: %v", name, err)
+	}
+}
+
+func TestResolveSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		schema string // "" for a generated one
+		owned  bool
+		ok     bool
+	}{
+		{"generated", Config{}, "", true, true},
+		{"kept dataset", Config{KeepData: true}, datasetSchema, false, true},
+		{"named", Config{Schema: "loadtest_ci"}, "loadtest_ci", false, true},
+		{"named with kept data", Config{Schema: "loadtest_ci", KeepData: true}, "loadtest_ci", false, true},
+		{"not a load test schema", Config{Schema: "public"}, "public", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, owned, err := resolveSchema(tt.cfg)
+			if (err == nil) != tt.ok {
+				t.Fatalf("resolveSchema() error = %v, want ok = %v", err, tt.ok)
+			}
+			if owned != tt.owned {
+				t.Errorf("owned = %v, want %v", owned, tt.owned)
+			}
+			if tt.schema != "" && schema != tt.schema {
+				t.Errorf("schema = %q, want %q", schema, tt.schema)
+			}
+			if tt.schema == "" && validSchemaName(schema) != nil {
+				t.Errorf("generated schema %q is not valid", schema)
+			}
+		})
+	}
+}
+
+func TestDropSchema(t *testing.T) {
+	newCluster := fakeAnswer{match: "to_regclass($1) IS NOT NULL, EXISTS", rows: [][]driver.Value{{false, false}}}
+	foreignSchema := fakeAnswer{match: "to_regclass($1) IS NOT NULL, EXISTS", rows: [][]driver.Value{{false, true}}}
+
+	tests := []struct {
+		name    string
+		schema  string
+		answers []fakeAnswer
+		ok      bool
+		queried bool // the database was asked anything
+		dropped bool
+	}{
+		{"load test schema", "loadtest_ci", []fakeAnswer{newCluster}, true, true, true},
+		{"invalid name", "public", nil, false, false, false},
+		{"quoted name", `loadtest_x" CASCADE; --`, nil, false, false, false},
+		{"schema not created by the load test", "loadtest_ci", []fakeAnswer{foreignSchema}, false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := openFakeDB(t, tt.answers...)
+			if err := dropSchema(db, tt.schema); (err == nil) != tt.ok {
+				t.Fatalf("dropSchema(%q) = %v, want ok = %v", tt.schema, err, tt.ok)
+			}
+			if queried := len(f.queries) > 0; queried != tt.queried {
+				t.Errorf("queried the database = %v, want %v", queried, tt.queried)
+			}
+			if dropped := f.ran("DROP SCHEMA"); dropped != tt.dropped {
+				t.Errorf("dropped = %v, want %v", dropped, tt.dropped)
+			}
+			if tt.dropped && !f.ran("DELETE FROM "+runRegistry) {
+				t.Error("the schema was not removed from the run registry")
+			}
+		})
+	}
+}
+
+func TestSearchPathParam(t *testing.T) {
+	if got := searchPathParam(""); got != "" {
+		t.Errorf("searchPathParam(\"\") = %q, want none", got)
+	}
+	if got, want := searchPathParam("loadtest_ci"), " search_path=loadtest_ci,public"; got != want {
+		t.Errorf("searchPathParam = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// datasetSchemaVersion changes whenever the test tables change, so a kept
+// dataset from an older version is seeded again
+const datasetSchemaVersion = 2
+
+// seedBatchRows is how many rows one COPY loads; each batch is its own
+// transaction, so progress moves and a failure loses little work
+const seedBatchRows = 50000
+
+// SeedOptions size the data the test tables are seeded with
+type SeedOptions struct {
+	Rows           int           `json:"rows"`            // loadtest_simple rows
+	TimeseriesRows int           `json:"timeseries_rows"` // loadtest_timeseries rows
+	Devices        int           `json:"devices"`         // device ids in the timeseries rows
+	Span           time.Duration `json:"span_ns"`         // timeseries rows are spread over this span up to now
+	ChunkInterval  time.Duration `json:"chunk_interval_ns,omitempty"`
+	Workers        int           `json:"workers"` // parallel COPY connections
+
+	// RandomSeed is the run seed the rows are generated from, so datasets
+	// seeded with different seeds have different fingerprints
+	RandomSeed int64 `json:"random_seed"`
+}
+
+// seedOptions returns the seed options of the run; initRunSeed must have been called
+func (c Config) seedOptions() SeedOptions {
+	return SeedOptions{
+		Rows:           c.SeedRows,
+		TimeseriesRows: c.SeedTimeseriesRows,
+		Devices:        c.SeedDevices,
+		Span:           c.SeedSpan,
+		ChunkInterval:  c.SeedChunkInterval,
+		Workers:        c.SeedWorkers,
+		RandomSeed:     runSeed,
+	}
+}
+
+func (o SeedOptions) validate() error {
+	if o.Rows < 0 || o.TimeseriesRows < 0 {
+		return fmt.Errorf("seed row counts must not be negative")
+	}
+	if o.Devices <= 0 || o.Workers <= 0 || o.Span <= 0 {
+		return fmt.Errorf("seed devices, workers and span must be positive")
+	}
+	if o.ChunkInterval < 0 {
+		return fmt.Errorf("chunk interval must not be negative")
+	}
+	return nil
+}
+
+// fingerprint identifies the dataset these options produce. The number of
+// workers does not change the data and is left out.
+func (o SeedOptions) fingerprint() string {
+	o.Workers = 0
+	b, _ := json.Marshal(struct {
+		Version int         `json:"version"`
+		Seed    SeedOptions `json:"seed"`
+	}{datasetSchemaVersion, o})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// recordDataset stores the fingerprint and the end of the time series of the
+// freshly seeded tables of schema
+func recordDataset(db *sql.DB, schema string, opts SeedOptions, end time.Time) error {
+	table := qualify(schema, "loadtest_dataset")
+	seed, _ := json.Marshal(opts)
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			fingerprint TEXT NOT NULL,
+			schema_version INTEGER NOT NULL,
+			seed JSONB NOT NULL,
+			seed_end TIMESTAMPTZ NOT NULL,
+			seeded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`DELETE FROM ` + table,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("failed to execute: %s - %w", q, err)
+		}
+	}
+	_, err := db.Exec(`INSERT INTO `+table+` (fingerprint, schema_version, seed, seed_end) VALUES ($1, $2, $3, $4)`,
+		opts.fingerprint(), datasetSchemaVersion, string(seed), end)
+	return err
+}
+
+// keptDataset returns when the tables of schema were seeded with the same
+// fingerprint, and false if they are missing or were seeded differently
+func keptDataset(db *sql.DB, schema, fingerprint string) (time.Time, bool, error) {
+	table := qualify(schema, "loadtest_dataset")
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil || !exists {
+		return time.Time{}, false, err
+	}
+	var seededAt time.Time
+	err := db.QueryRow(`SELECT seeded_at FROM `+table+` WHERE fingerprint = $1 AND schema_version = $2`,
+		fingerprint, datasetSchemaVersion).Scan(&seededAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	return seededAt, err == nil, err
+}
+
+// keptSeed returns the run seed of the dataset kept in schema if it was seeded
+// with opts in every other respect
+func keptSeed(db *sql.DB, schema string, opts SeedOptions) (int64, bool, error) {
+	table := qualify(schema, "loadtest_dataset")
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil || !exists {
+		return 0, false, err
+	}
+	var stored []byte
+	err := db.QueryRow(`SELECT seed FROM `+table+` WHERE schema_version = $1`, datasetSchemaVersion).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	var kept SeedOptions
+	if err := json.Unmarshal(stored, &kept); err != nil {
+		return 0, false, err
+	}
+	seed := kept.RandomSeed
+	kept.RandomSeed, kept.Workers = opts.RandomSeed, opts.Workers
+	return seed, kept == opts, nil
+}
+
+// datasetEnd returns the end of the seeded time series in schema, or the zero
+// time if the tables were not seeded by this version of the tool
+func datasetEnd(db *sql.DB, schema string) (time.Time, error) {
+	table := qualify(schema, "loadtest_dataset")
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil || !exists {
+		return time.Time{}, err
+	}
+	var end time.Time
+	err := db.QueryRow(`SELECT seed_end FROM `+table+` WHERE schema_version = $1`, datasetSchemaVersion).Scan(&end)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return end, err
+}
+
+// testTablesExist reports whether schema already holds all the test tables
+func testTablesExist(db *sql.DB, schema string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL AND to_regclass($2) IS NOT NULL AND to_regclass($3) IS NOT NULL`,
+		qualify(schema, "loadtest_simple"), qualify(schema, "loadtest_timeseries"), qualify(schema, "loadtest_replication")).Scan(&exists)
+	return exists, err
+}
+
+// seedTables loads the seed data into the test tables of schema, with the time
+// series ending at end
+func seedTables(db *sql.DB, schema string, opts SeedOptions, end time.Time) error {
+	err := copyRows(db, schema, "loadtest_simple", []string{"data", "value"}, opts.Rows, opts.Workers,
+		func(r *rand.Rand, i int) []any {
+			return []any{fmt.Sprintf("initial_data_%d", i), r.Intn(10000)}
+		})
+	if err != nil {
+		return err
+	}
+
+	// Evenly spaced up to end, so time range queries find data at any offset
+	step := opts.Span / time.Duration(max(opts.TimeseriesRows, 1))
+	return copyRows(db, schema, "loadtest_timeseries", []string{"time", "device_id", "temperature", "humidity", "pressure"},
+		opts.TimeseriesRows, opts.Workers,
+		func(r *rand.Rand, i int) []any {
+			return []any{
+				end.Add(-opts.Span + time.Duration(i)*step),
+				fmt.Sprintf("device_%d", r.Intn(opts.Devices)),
+				20 + r.Float64()*15,
+				30 + r.Float64()*50,
+				1000 + r.Float64()*50,
+			}
+		})
+}
+
+// copyRows loads rows generated by row into table with COPY, split into batches
+// that workers load in parallel
+func copyRows(db *sql.DB, schema, table string, columns []string, rows, workers int, row func(r *rand.Rand, i int) []any) error {
+	if rows == 0 {
+		return nil
+	}
+
+	batches := make(chan int)
+	var loaded int64
+	var firstErr error
+	var errOnce sync.Once
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				end := min(start+seedBatchRows, rows)
+				// Seeded per batch: whichever worker loads a batch, its rows are the same
+				r := derivedRand("seed", table, start)
+				if err := copyBatch(ctx, db, schema, table, columns, start, end, r, row); err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("failed to seed %s: %w", table, err)
+						cancel()
+					})
+					continue
+				}
+				atomic.AddInt64(&loaded, int64(end-start))
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go seedProgress(table, rows, &loaded, done)
+
+	start := time.Now()
+feed:
+	for i := 0; i < rows; i += seedBatchRows {
+		select {
+		case batches <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(batches)
+	wg.Wait()
+	close(done)
+
+	if firstErr != nil {
+		return firstErr
+	}
+	elapsed := time.Since(start)
+	logSuccess(fmt.Sprintf("Seeded %s with %d rows in %v (%.0f rows/s)", table, rows, elapsed.Round(time.Millisecond), float64(rows)/elapsed.Seconds()))
+	return nil
+}
+
+func copyBatch(ctx context.Context, db *sql.DB, schema, table string, columns []string, start, end int, r *rand.Rand, row func(r *rand.Rand, i int) []any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(schema, table, columns...))
+	if err != nil {
+		return err
+	}
+	for i := start; i < end; i++ {
+		if _, err := stmt.ExecContext(ctx, row(r, i)...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	// The final Exec without arguments flushes the COPY
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// seedProgress prints how much of table is loaded until done is closed
+func seedProgress(table string, rows int, loaded *int64, done chan struct{}) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-done:
+			fmt.Print("\r                                                                                \r")
+			return
+		case <-ticker.C:
+			n := atomic.LoadInt64(loaded)
+			fmt.Printf("\r   Seeding %s... %d/%d rows (%.0f%%) | %.0f rows/s   ",
+				table, n, rows, float64(n)/float64(rows)*100, float64(n)/time.Since(start).Seconds())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSeedOptionsFingerprint(t *testing.T) {
+	base := SeedOptions{Rows: 1000, TimeseriesRows: 1000, Devices: 10, Span: 24 * time.Hour, Workers: 4, RandomSeed: 7}
+	tests := []struct {
+		name   string
+		modify func(o *SeedOptions)
+		same   bool
+	}{
+		{"unchanged", func(o *SeedOptions) {}, true},
+		{"workers", func(o *SeedOptions) { o.Workers = 16 }, true},
+		{"rows", func(o *SeedOptions) { o.Rows = 2000 }, false},
+		{"timeseries rows", func(o *SeedOptions) { o.TimeseriesRows = 2000 }, false},
+		{"devices", func(o *SeedOptions) { o.Devices = 11 }, false},
+		{"span", func(o *SeedOptions) { o.Span = time.Hour }, false},
+		{"chunk interval", func(o *SeedOptions) { o.ChunkInterval = 6 * time.Hour }, false},
+		{"random seed", func(o *SeedOptions) { o.RandomSeed = 8 }, false},
+	}
+	want := base.fingerprint()
+	if len(want) != 16 {
+		t.Fatalf("fingerprint %q, want 16 hex digits", want)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := base
+			tt.modify(&o)
+			if got := o.fingerprint(); (got == want) != tt.same {
+				t.Errorf("fingerprint = %s, base %s, want same = %v", got, want, tt.same)
+			}
+		})
+	}
+}
+
+func TestSeedOptionsValidate(t *testing.T) {
+	valid := SeedOptions{Rows: 1000, TimeseriesRows: 1000, Devices: 10, Span: time.Hour, Workers: 4}
+	tests := []struct {
+		name   string
+		modify func(o *SeedOptions)
+		ok     bool
+	}{
+		{"valid", func(o *SeedOptions) {}, true},
+		{"no rows", func(o *SeedOptions) { o.Rows, o.TimeseriesRows = 0, 0 }, true},
+		{"negative rows", func(o *SeedOptions) { o.Rows = -1 }, false},
+		{"no devices", func(o *SeedOptions) { o.Devices = 0 }, false},
+		{"no workers", func(o *SeedOptions) { o.Workers = 0 }, false},
+		{"no span", func(o *SeedOptions) { o.Span = 0 }, false},
+		{"negative chunk interval", func(o *SeedOptions) { o.ChunkInterval = -time.Hour }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := valid
+			tt.modify(&o)
+			if err := o.validate(); (err == nil) != tt.ok {
+				t.Errorf("validate() = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSeedOptionsUseRunSeed(t *testing.T) {
+	defer func(seed int64) { runSeed = seed }(runSeed)
+	runSeed = 1234
+	if got := (Config{}).seedOptions().RandomSeed; got != 1234 {
+		t.Errorf("seed options without RANDOM_SEED record seed %d, want the run seed 1234", got)
+	}
+}
+
+func TestKeptSeed(t *testing.T) {
+	opts := SeedOptions{Rows: 1000, TimeseriesRows: 1000, Devices: 10, Span: time.Hour, Workers: 4, RandomSeed: 1}
+	stored := func(o SeedOptions) fakeAnswer {
+		b, _ := json.Marshal(o)
+		return fakeAnswer{match: "SELECT seed FROM", rows: [][]driver.Value{{b}}}
+	}
+	tableExists := func(ok bool) fakeAnswer {
+		return fakeAnswer{match: "to_regclass", rows: [][]driver.Value{{ok}}}
+	}
+	kept := opts
+	kept.RandomSeed, kept.Workers = 99, 8
+	moreRows := kept
+	moreRows.Rows = 5000
+
+	tests := []struct {
+		name    string
+		answers []fakeAnswer
+		seed    int64
+		ok      bool
+	}{
+		{"no dataset table", []fakeAnswer{tableExists(false)}, 0, false},
+		{"no dataset", []fakeAnswer{tableExists(true)}, 0, false},
+		{"same options", []fakeAnswer{tableExists(true), stored(kept)}, 99, true},
+		{"other options", []fakeAnswer{tableExists(true), stored(moreRows)}, 99, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openFakeDB(t, tt.answers...)
+			seed, ok, err := keptSeed(db, datasetSchema, opts)
+			if err != nil {
+				t.Fatalf("keptSeed: %v", err)
+			}
+			if ok != tt.ok || (ok && seed != tt.seed) {
+				t.Errorf("keptSeed() = %d, %v; want %d, %v", seed, ok, tt.seed, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Exit codes
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitSLOFailed = 3
+)
+
+// exitCode is the exit code of a command that ran its tests: exitError if the
+// results could not be saved, else exitSLOFailed if a check failed
+func exitCode(saveErr error, passed bool) int {
+	switch {
+	case saveErr != nil:
+		return exitError
+	case !passed:
+		return exitSLOFailed
+	}
+	return exitOK
+}
+
+// Assertions are pass/fail thresholds for a load test. Zero fields are not checked.
+type Assertions struct {
+	MinOpsPerSec float64  `json:"min_ops_per_sec,omitempty"`
+	MaxP99       Duration `json:"max_p99,omitempty"`
+	MaxErrorRate float64  `json:"max_error_rate,omitempty"` // percent
+}
+
+// ReplicationAssertions are pass/fail thresholds for the replication lag test.
+// Zero fields are not checked; when any is set, samples that timed out fail too.
+type ReplicationAssertions struct {
+	MaxAvgLag Duration `json:"max_avg_lag,omitempty"`
+	MaxP99Lag Duration `json:"max_p99_lag,omitempty"`
+	MaxLag    Duration `json:"max_lag,omitempty"`
+}
+
+// check returns a description of every threshold the result violates
+func (a *Assertions) check(r TestResult) []string {
+	if r.TotalOps == 0 {
+		return []string{"no operations completed"}
+	}
+
+	var violations []string
+	if a.MinOpsPerSec > 0 && r.OpsPerSecond < a.MinOpsPerSec {
+		violations = append(violations, fmt.Sprintf("throughput %.2f ops/s < %.2f ops/s", r.OpsPerSecond, a.MinOpsPerSec))
+	}
+	if a.MaxP99 > 0 && r.P99Latency > time.Duration(a.MaxP99) {
+		violations = append(violations, fmt.Sprintf("P99 %v > %v", r.P99Latency.Round(time.Microsecond), time.Duration(a.MaxP99)))
+	}
+	errorRate := float64(r.FailedOps) / float64(r.TotalOps) * 100
+	if a.MaxErrorRate > 0 && errorRate > a.MaxErrorRate {
+		violations = append(violations, fmt.Sprintf("error rate %.2f%% > %.2f%%", errorRate, a.MaxErrorRate))
+	}
+	return violations
+}
+
+func (a *ReplicationAssertions) isSet() bool {
+	return a != nil && (a.MaxAvgLag > 0 || a.MaxP99Lag > 0 || a.MaxLag > 0)
+}
+
+// check returns a description of every threshold the result violates
+func (a *ReplicationAssertions) check(r ReplicationResult) []string {
+	if !a.isSet() {
+		return nil
+	}
+
+	var violations []string
+	if r.FailedCount > 0 {
+		violations = append(violations, fmt.Sprintf("%d of %d samples failed or timed out", r.FailedCount, r.TestCount))
+	}
+	if a.MaxAvgLag > 0 && r.AvgLag > time.Duration(a.MaxAvgLag) {
+		violations = append(violations, fmt.Sprintf("avg lag %v > %v", r.AvgLag.Round(time.Microsecond), time.Duration(a.MaxAvgLag)))
+	}
+	if a.MaxP99Lag > 0 && r.P99Lag > time.Duration(a.MaxP99Lag) {
+		violations = append(violations, fmt.Sprintf("P99 lag %v > %v", r.P99Lag.Round(time.Microsecond), time.Duration(a.MaxP99Lag)))
+	}
+	if a.MaxLag > 0 && r.MaxLag > time.Duration(a.MaxLag) {
+		violations = append(violations, fmt.Sprintf("max lag %v > %v", r.MaxLag.Round(time.Microsecond), time.Duration(a.MaxLag)))
+	}
+	return violations
+}
+
+func printViolations(label string, violations []string) {
+	if len(violations) == 0 {
+		fmt.Printf("   %s[PASS]%s %s: all thresholds met\n", Green, Reset, label)
+		return
+	}
+	fmt.Printf("   %s[FAIL]%s %s: %s\n", Red, Reset, label, strings.Join(violations, "; "))
+}
+
+// printSLOSummary prints the overall verdict and reports whether every checked SLO passed
+func printSLOSummary(results []TestResult, replication *ReplicationResult) bool {
+	checked, failed := 0, 0
+	for _, r := range results {
+		if r.Assertions != nil {
+			checked++
+			if len(r.Violations) > 0 {
+				failed++
+			}
+		}
+		// A stale read the proxy's load balance mode should have prevented fails the run
+		if r.ReadYourWrites != nil {
+			checked++
+			if !r.ReadYourWrites.Passed {
+				failed++
+			}
+		}
+	}
+	replicationFailed := replication != nil && len(replication.Violations) > 0
+	if replication != nil && replication.Assertions.isSet() {
+		checked++
+		if replicationFailed {
+			failed++
+		}
+	}
+
+	if checked == 0 {
+		return true
+	}
+
+	printSection("SLO Summary")
+	fmt.Println()
+	for _, r := range results {
+		if r.Assertions != nil {
+			printViolations(r.Name, r.Violations)
+		}
+		if r.ReadYourWrites != nil {
+			printViolations(r.Name+" read-your-writes", r.ReadYourWrites.violations())
+		}
+	}
+	if replication != nil && replication.Assertions.isSet() {
+		printViolations("Replication Lag", replication.Violations)
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		fmt.Printf("   %s[FAIL]%s %d of %d SLO checks failed\n", Red, Reset, failed, checked)
+		return false
+	}
+	fmt.Printf("   %s[PASS]%s All %d SLO checks passed\n", Green, Reset, checked)
+	return true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAssertionsCheck(t *testing.T) {
+	ms := time.Millisecond
+	result := TestResult{TotalOps: 100, SuccessOps: 98, FailedOps: 2, OpsPerSecond: 500, P99Latency: 20 * ms}
+
+	tests := []struct {
+		name   string
+		assert Assertions
+		result TestResult
+		want   []string
+	}{
+		{"nothing set", Assertions{}, result, nil},
+		{"all met", Assertions{MinOpsPerSec: 400, MaxP99: Duration(25 * ms), MaxErrorRate: 5}, result, nil},
+		{"limits are inclusive", Assertions{MinOpsPerSec: 500, MaxP99: Duration(20 * ms), MaxErrorRate: 2}, result, nil},
+		{"throughput", Assertions{MinOpsPerSec: 600}, result, []string{"throughput 500.00 ops/s < 600.00 ops/s"}},
+		{"p99", Assertions{MaxP99: Duration(10 * ms)}, result, []string{"P99 20ms > 10ms"}},
+		{"error rate", Assertions{MaxErrorRate: 1}, result, []string{"error rate 2.00% > 1.00%"}},
+		{"several", Assertions{MinOpsPerSec: 600, MaxErrorRate: 1}, result,
+			[]string{"throughput 500.00 ops/s < 600.00 ops/s", "error rate 2.00% > 1.00%"}},
+		{"no operations", Assertions{MaxErrorRate: 1}, TestResult{}, []string{"no operations completed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.assert.check(tt.result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplicationAssertionsCheck(t *testing.T) {
+	ms := time.Millisecond
+	result := ReplicationResult{LagStats: LagStats{TestCount: 10, SuccessCount: 10, AvgLag: 2 * ms, P99Lag: 8 * ms, MaxLag: 9 * ms}}
+	timedOut := result
+	timedOut.FailedCount, timedOut.SuccessCount = 1, 9
+
+	tests := []struct {
+		name   string
+		assert *ReplicationAssertions
+		result ReplicationResult
+		want   []string
+	}{
+		{"no assertions", nil, timedOut, nil},
+		{"nothing set", &ReplicationAssertions{}, timedOut, nil},
+		{"all met", &ReplicationAssertions{MaxAvgLag: Duration(5 * ms), MaxP99Lag: Duration(10 * ms), MaxLag: Duration(10 * ms)}, result, nil},
+		{"avg", &ReplicationAssertions{MaxAvgLag: Duration(ms)}, result, []string{"avg lag 2ms > 1ms"}},
+		{"p99 and max", &ReplicationAssertions{MaxP99Lag: Duration(5 * ms), MaxLag: Duration(5 * ms)}, result,
+			[]string{"P99 lag 8ms > 5ms", "max lag 9ms > 5ms"}},
+		{"timed out samples", &ReplicationAssertions{MaxLag: Duration(time.Second)}, timedOut, []string{"1 of 10 samples failed or timed out"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.assert.check(tt.result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintSLOSummary(t *testing.T) {
+	checked := &Assertions{MaxErrorRate: 1}
+	replicationAssert := &ReplicationAssertions{MaxLag: Duration(time.Second)}
+
+	tests := []struct {
+		name        string
+		results     []TestResult
+		replication *ReplicationResult
+		want        bool
+	}{
+		{"nothing checked", []TestResult{{Name: "a", Violations: []string{"ignored without assertions"}}}, nil, true},
+		{"test passed", []TestResult{{Name: "a", Assertions: checked}}, nil, true},
+		{"test failed", []TestResult{{Name: "a", Assertions: checked}, {Name: "b", Assertions: checked, Violations: []string{"x"}}}, nil, false},
+		{"stale protected read", []TestResult{{Name: "ryw", ReadYourWrites: &ReadYourWritesResult{Passed: false}}}, nil, false},
+		{"stale unprotected read", []TestResult{{Name: "ryw", ReadYourWrites: &ReadYourWritesResult{Passed: true}}}, nil, true},
+		{"replication failed", nil, &ReplicationResult{Assertions: replicationAssert, Violations: []string{"x"}}, false},
+		{"replication without assertions", nil, &ReplicationResult{Violations: []string{"x"}}, true},
+		{"replication passed", nil, &ReplicationResult{Assertions: replicationAssert}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := printSLOSummary(tt.results, tt.replication); got != tt.want {
+				t.Errorf("printSLOSummary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	saveErr := errors.New("disk full")
+	tests := []struct {
+		name    string
+		saveErr error
+		passed  bool
+		want    int
+	}{
+		{"passed", nil, true, exitOK},
+		{"check failed", nil, false, exitSLOFailed},
+		{"results not saved", saveErr, true, exitError},
+		{"both", saveErr, false, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.saveErr, tt.passed); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCLIUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"help", []string{"help"}, exitOK},
+		{"command help", []string{"janitor", "-h"}, exitOK},
+		{"unknown command", []string{"bogus"}, exitUsage},
+		{"unknown flag", []string{"run", "-no-such-flag"}, exitUsage},
+		{"bad flag value", []string{"janitor", "-max-age", "soon"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runCLI(tt.args); got != tt.want {
+				t.Errorf("runCLI(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
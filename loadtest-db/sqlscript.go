@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQL script workload
+//
+// Scripts follow pgbench's format: one SQL statement per line or spread over
+// lines up to a closing ';', "--" comments, and \set meta-commands that assign
+// a variable before the statements that use it as :name. Variables are passed
+// as bind parameters, never spliced into the SQL. Quoted text is left alone:
+// a ';' or :name inside a string literal, quoted identifier or dollar-quoted
+// body neither ends a statement nor refers to a variable.
+//
+//	\set id random(1, 1000)
+//	\set device device(100)
+//	\set since random_time(3600)
+//	BEGIN;
+//	UPDATE loadtest_simple SET value = value + 1 WHERE id = :id;
+//	SELECT avg(temperature) FROM loadtest_timeseries WHERE device_id = :device AND time > :since;
+//	COMMIT;
+
+// sqlScript is a parsed script file
+type sqlScript struct {
+	path     string
+	weight   int
+	sets     []scriptSet
+	commands []scriptCommand
+}
+
+// scriptSet is a \set meta-command
+type scriptSet struct {
+	name string
+	eval func(w *Worker) any
+}
+
+// scriptCommand is one SQL statement with its :variables replaced by $1, $2, ...
+type scriptCommand struct {
+	sql  string
+	args []string // variable names in parameter order
+	tx   string   // "begin", "commit" or "rollback" for transaction control
+}
+
+// sqlScriptWorkload runs a weighted choice of SQL scripts per operation
+type sqlScriptWorkload struct {
+	mu      sync.Mutex
+	scripts map[string][]*sqlScript // parsed scripts by Params.Scripts
+}
+
+func init() {
+	registerWorkload("sql_script", &sqlScriptWorkload{scripts: map[string][]*sqlScript{}})
+}
+
+func (s *sqlScriptWorkload) Description() string {
+	return "pgbench-style SQL script files chosen by weight (scripts: [\"file.sql@weight\", ...])"
+}
+
+func (s *sqlScriptWorkload) Defaults() WorkloadParams { return WorkloadParams{} }
+
+// Setup parses the scripts once per test, so a syntax error stops the test
+// before any load is generated
+func (s *sqlScriptWorkload) Setup(db *sql.DB, params WorkloadParams) error {
+	if len(params.Scripts) == 0 {
+		return fmt.Errorf("sql_script needs params.scripts")
+	}
+	scripts := make([]*sqlScript, 0, len(params.Scripts))
+	total := 0
+	for _, spec := range params.Scripts {
+		script, err := loadSQLScript(spec)
+		if err != nil {
+			return err
+		}
+		total += script.weight
+		scripts = append(scripts, script)
+	}
+	if total == 0 {
+		return fmt.Errorf("sql_script: all script weights are zero")
+	}
+
+	s.mu.Lock()
+	s.scripts[scriptsKey(params)] = scripts
+	s.mu.Unlock()
+	return nil
+}
+
+// ReadOnly reports whether every statement of every script only reads
+func (s *sqlScriptWorkload) ReadOnly(params WorkloadParams) bool {
+	for _, spec := range params.Scripts {
+		script, err := loadSQLScript(spec)
+		if err != nil {
+			return false
+		}
+		for _, c := range script.commands {
+			if c.tx == "" && !isReadOnlySQL(c.sql) {
+				return false
+			}
+		}
+	}
+	return len(params.Scripts) > 0
+}
+
+func (s *sqlScriptWorkload) Teardown(db *sql.DB, params WorkloadParams) error {
+	s.mu.Lock()
+	delete(s.scripts, scriptsKey(params))
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *sqlScriptWorkload) Run(db *sql.DB, w *Worker) error {
+	scripts, ok := w.State.([]*sqlScript)
+	if !ok {
+		s.mu.Lock()
+		scripts = s.scripts[scriptsKey(w.Params)]
+		s.mu.Unlock()
+		w.State = scripts
+	}
+	return pickScript(scripts, w.Rand).run(db, w)
+}
+
+func scriptsKey(params WorkloadParams) string {
+	return strings.Join(params.Scripts, "\x00")
+}
+
+// pickScript chooses a script with probability proportional to its weight
+func pickScript(scripts []*sqlScript, r *rand.Rand) *sqlScript {
+	total := 0
+	for _, s := range scripts {
+		total += s.weight
+	}
+	n := r.Intn(total)
+	for _, s := range scripts {
+		if n < s.weight {
+			return s
+		}
+		n -= s.weight
+	}
+	return scripts[len(scripts)-1]
+}
+
+// run evaluates the \set variables and executes the statements in order. A
+// transaction left open at the end of the script is committed.
+func (s *sqlScript) run(db *sql.DB, w *Worker) error {
+	vars := map[string]any{"client_id": w.ID}
+	for _, set := range s.sets {
+		vars[set.name] = set.eval(w)
+	}
+
+	var tx *sql.Tx
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, c := range s.commands {
+		var err error
+		switch c.tx {
+		case "begin":
+			if tx != nil {
+				return fmt.Errorf("%s: BEGIN inside a transaction", s.path)
+			}
+			tx, err = db.Begin()
+		case "commit":
+			if tx != nil {
+				err = tx.Commit()
+				tx = nil
+			}
+		case "rollback":
+			if tx != nil {
+				err = tx.Rollback()
+				tx = nil
+			}
+		default:
+			args := make([]any, len(c.args))
+			for i, name := range c.args {
+				args[i] = vars[name]
+			}
+			if tx != nil {
+				_, err = tx.Exec(c.sql, args...)
+			} else {
+				_, err = db.Exec(c.sql, args...)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.path, err)
+		}
+	}
+
+	if tx != nil {
+		err := tx.Commit()
+		tx = nil
+		return err
+	}
+	return nil
+}
+
+// loadSQLScript reads and parses a "path" or "path@weight" script spec
+func loadSQLScript(spec string) (*sqlScript, error) {
+	path, weight := spec, 1
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		w, err := strconv.Atoi(spec[i+1:])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("script %q: weight must be a non-negative integer", spec)
+		}
+		path, weight = spec[:i], w
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	script, err := parseSQLScript(path, data)
+	if err != nil {
+		return nil, err
+	}
+	script.weight = weight
+	return script, nil
+}
+
+// scriptVarRef matches :name, but not the second colon of a :: cast. It is
+// only applied outside quoted text.
+var scriptVarRef = regexp.MustCompile(`(^|[^:]):([A-Za-z_][A-Za-z0-9_]*)`)
+
+func parseSQLScript(path string, data []byte) (*sqlScript, error) {
+	script := &sqlScript{path: path}
+	defined := map[string]bool{"client_id": true}
+
+	var pending []string
+	var statements []string
+	lineNo := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lineNo++
+		// Lines inside a quoted string belong to it as they are
+		if len(pending) > 0 && !quotesClosed(pendingStatement(pending)) {
+			pending = append(pending, scanner.Text())
+			if stmt := pendingStatement(pending); statementEnds(stmt) {
+				statements = append(statements, strings.TrimSuffix(stmt, ";"))
+				pending = nil
+			}
+			continue
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+
+		if strings.HasPrefix(line, `\`) {
+			if len(pending) > 0 {
+				return nil, fmt.Errorf("%s:%d: meta-command inside an SQL statement", path, lineNo)
+			}
+			fields := strings.Fields(line)
+			if fields[0] != `\set` || len(fields) < 3 {
+				return nil, fmt.Errorf("%s:%d: unsupported meta-command %q (only \\set name expression)", path, lineNo, line)
+			}
+			eval, err := parseScriptExpr(strings.Join(fields[2:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+			script.sets = append(script.sets, scriptSet{name: fields[1], eval: eval})
+			defined[fields[1]] = true
+			continue
+		}
+
+		pending = append(pending, line)
+		if stmt := pendingStatement(pending); statementEnds(stmt) {
+			statements = append(statements, strings.TrimSuffix(stmt, ";"))
+			pending = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(pending) > 0 {
+		statements = append(statements, pendingStatement(pending))
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("%s: no SQL statements", path)
+	}
+
+	for _, stmt := range statements {
+		c, err := parseScriptCommand(stmt, defined)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		script.commands = append(script.commands, c)
+	}
+	return script, nil
+}
+
+// transactionControl returns "begin", "commit" or "rollback" if stmt is a
+// transaction control statement, and "" otherwise
+func transactionControl(stmt string) string {
+	switch strings.ToUpper(strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimSpace(stmt), ";")), " ")) {
+	case "BEGIN", "BEGIN TRANSACTION", "BEGIN WORK", "START TRANSACTION":
+		return "begin"
+	case "COMMIT", "COMMIT TRANSACTION", "COMMIT WORK", "END", "END TRANSACTION":
+		return "commit"
+	case "ROLLBACK", "ROLLBACK TRANSACTION", "ROLLBACK WORK", "ABORT":
+		return "rollback"
+	}
+	return ""
+}
+
+func parseScriptCommand(stmt string, defined map[string]bool) (scriptCommand, error) {
+	if tx := transactionControl(stmt); tx != "" {
+		return scriptCommand{tx: tx}, nil
+	}
+
+	c := scriptCommand{}
+	params := map[string]int{}
+	var err error
+	c.sql, _ = mapUnquoted(stmt, func(part string) string {
+		return scriptVarRef.ReplaceAllStringFunc(part, func(m string) string {
+			sub := scriptVarRef.FindStringSubmatch(m)
+			name := sub[2]
+			if !defined[name] {
+				err = fmt.Errorf("undefined variable :%s", name)
+				return m
+			}
+			n, ok := params[name]
+			if !ok {
+				c.args = append(c.args, name)
+				n = len(c.args)
+				params[name] = n
+			}
+			return sub[1] + "$" + strconv.Itoa(n)
+		})
+	})
+	return c, err
+}
+
+// pendingStatement joins the lines of a statement, without the -- comments
+// outside quoted text, so "SELECT 1; -- note" ends at the ';'
+func pendingStatement(lines []string) string {
+	stmt := strings.Join(lines, "\n")
+	var b strings.Builder
+	for i := 0; i < len(stmt); {
+		if strings.HasPrefix(stmt[i:], "--") {
+			nl := strings.IndexByte(stmt[i:], '\n')
+			if nl < 0 {
+				break
+			}
+			i += nl
+			continue
+		}
+		end, _ := quotedEnd(stmt, i)
+		if end == i {
+			end = i + 1
+		}
+		b.WriteString(stmt[i:end])
+		i = end
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// statementEnds reports whether stmt ends with a ';' outside quoted text
+func statementEnds(stmt string) bool {
+	return strings.HasSuffix(stmt, ";") && quotesClosed(stmt)
+}
+
+// quotesClosed reports whether every quoted string in stmt is terminated
+func quotesClosed(stmt string) bool {
+	_, closed := mapUnquoted(stmt, func(part string) string { return part })
+	return closed
+}
+
+// mapUnquoted applies f to the parts of stmt outside single-quoted,
+// double-quoted and dollar-quoted text, which is copied as it is. closed is
+// false if the last quoted text runs to the end of stmt.
+func mapUnquoted(stmt string, f func(string) string) (out string, closed bool) {
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(stmt); {
+		end, ok := quotedEnd(stmt, i)
+		if end == i {
+			i++
+			continue
+		}
+		b.WriteString(f(stmt[start:i]))
+		b.WriteString(stmt[i:end])
+		if !ok {
+			return b.String(), false
+		}
+		start, i = end, end
+	}
+	b.WriteString(f(stmt[start:]))
+	return b.String(), true
+}
+
+// dollarQuote matches the opening tag of a dollar-quoted string, $$ or $tag$
+var dollarQuote = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// quotedEnd returns the index just past the quoted text starting at s[i], or i
+// if none starts there. ok is false if the text is not terminated in s.
+func quotedEnd(s string, i int) (end int, ok bool) {
+	switch q := s[i]; q {
+	case '\'', '"':
+		// E'...' strings take backslash escapes
+		escapes := q == '\'' && i > 0 && (s[i-1] == 'E' || s[i-1] == 'e') && (i == 1 || !isIdentByte(s[i-2]))
+		for j := i + 1; j < len(s); j++ {
+			switch {
+			case escapes && s[j] == '\\':
+				j++
+			case s[j] == q && j+1 < len(s) && s[j+1] == q:
+				j++ // doubled quote
+			case s[j] == q:
+				return j + 1, true
+			}
+		}
+		return len(s), false
+	case '$':
+		// $1 is a parameter, and a$b$ part of an identifier
+		if i > 0 && isIdentByte(s[i-1]) {
+			return i, true
+		}
+		tag := dollarQuote.FindString(s[i:])
+		if tag == "" {
+			return i, true
+		}
+		if n := strings.Index(s[i+len(tag):], tag); n >= 0 {
+			return i + 2*len(tag) + n, true
+		}
+		return len(s), false
+	}
+	return i, true
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+var scriptCall = regexp.MustCompile(`^([a-z_]+)\((.*)\)$`)
+
+// parseScriptExpr parses the expression of a \set: an integer, a 'string', or
+// one of random(lo, hi), random_double(lo, hi), device(n), now() and
+// random_time(seconds)
+func parseScriptExpr(expr string) (func(w *Worker) any, error) {
+	expr = strings.TrimSpace(expr)
+	if n, err := strconv.ParseInt(expr, 10, 64); err == nil {
+		return func(*Worker) any { return n }, nil
+	}
+	if len(expr) >= 2 && expr[0] == '\'' && expr[len(expr)-1] == '\'' {
+		s := expr[1 : len(expr)-1]
+		return func(*Worker) any { return s }, nil
+	}
+
+	m := scriptCall.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("cannot parse expression %q", expr)
+	}
+	var args []float64
+	if strings.TrimSpace(m[2]) != "" {
+		for _, a := range strings.Split(m[2], ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: arguments must be numbers", m[1])
+			}
+			args = append(args, v)
+		}
+	}
+	want := map[string]int{"random": 2, "random_double": 2, "device": 1, "now": 0, "random_time": 1}
+	n, ok := want[m[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s()", m[1])
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("%s() takes %d arguments", m[1], n)
+	}
+
+	switch m[1] {
+	case "random":
+		lo, hi := int64(args[0]), int64(args[1])
+		if hi < lo {
+			return nil, fmt.Errorf("random(%d, %d): upper bound below lower bound", lo, hi)
+		}
+		return func(w *Worker) any { return lo + w.Rand.Int63n(hi-lo+1) }, nil
+	case "random_double":
+		lo, hi := args[0], args[1]
+		return func(w *Worker) any { return lo + w.Rand.Float64()*(hi-lo) }, nil
+	case "device":
+		devices := int(args[0])
+		if devices <= 0 {
+			return nil, fmt.Errorf("device(%d): need at least one device", devices)
+		}
+		return func(w *Worker) any { return fmt.Sprintf("device_%d", w.Rand.Intn(devices)) }, nil
+	case "now":
+		return func(*Worker) any { return time.Now() }, nil
+	default: // random_time
+		window := time.Duration(args[0] * float64(time.Second))
+		if window <= 0 {
+			return nil, fmt.Errorf("random_time(%g): window must be positive", args[0])
+		}
+		return func(w *Worker) any { return w.now().Add(-time.Duration(w.Rand.Int63n(int64(window)))) }, nil
+	}
+}
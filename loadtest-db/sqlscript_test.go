@@ -0,0 +1,179 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSQLScriptStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		sql    []string
+		args   [][]string
+	}{
+		{
+			name:   "variables become parameters",
+			script: "\\set id random(1, 10)\nSELECT * FROM t WHERE id = :id AND other = :id;\n",
+			sql:    []string{"SELECT * FROM t WHERE id = $1 AND other = $1"},
+			args:   [][]string{{"id"}},
+		},
+		{
+			name:   "statement over several lines",
+			script: "-- comment\nSELECT 1\n  FROM t\n WHERE x = 1;\n\nSELECT 2;\n",
+			sql:    []string{"SELECT 1\nFROM t\nWHERE x = 1", "SELECT 2"},
+			args:   [][]string{nil, nil},
+		},
+		{
+			name:   "cast is not a variable",
+			script: "\\set id random(1, 10)\nSELECT :id::text;\n",
+			sql:    []string{"SELECT $1::text"},
+			args:   [][]string{{"id"}},
+		},
+		{
+			name:   "colon in a string literal",
+			script: "SELECT 'a:b';\n",
+			sql:    []string{"SELECT 'a:b'"},
+			args:   [][]string{nil},
+		},
+		{
+			name:   "variable next to a literal",
+			script: "\\set id random(1, 10)\nSELECT 'it''s :id', :id;\n",
+			sql:    []string{"SELECT 'it''s :id', $1"},
+			args:   [][]string{{"id"}},
+		},
+		{
+			name:   "escape string",
+			script: "SELECT E'a\\':b';\n",
+			sql:    []string{"SELECT E'a\\':b'"},
+			args:   [][]string{nil},
+		},
+		{
+			name:   "quoted identifier",
+			script: "SELECT 1 AS \"x:y;\";\n",
+			sql:    []string{"SELECT 1 AS \"x:y;\""},
+			args:   [][]string{nil},
+		},
+		{
+			name:   "semicolon at the end of a line in a literal",
+			script: "SELECT 'x;\ny';\nSELECT 2;\n",
+			sql:    []string{"SELECT 'x;\ny'", "SELECT 2"},
+			args:   [][]string{nil, nil},
+		},
+		{
+			name:   "literal keeps blank and comment lines",
+			script: "SELECT 'a\n\n-- b\n  c';\n",
+			sql:    []string{"SELECT 'a\n\n-- b\n  c'"},
+			args:   [][]string{nil},
+		},
+		{
+			name:   "dollar-quoted body",
+			script: "DO $body$\nBEGIN\n  PERFORM 'x:y';\nEND;\n$body$;\nSELECT $$a;$$;\n",
+			sql:    []string{"DO $body$\nBEGIN\n  PERFORM 'x:y';\nEND;\n$body$", "SELECT $$a;$$"},
+			args:   [][]string{nil, nil},
+		},
+		{
+			name:   "comment after the terminator",
+			script: "SELECT 1; -- first\nSELECT 2;-- it's the last\n",
+			sql:    []string{"SELECT 1", "SELECT 2"},
+			args:   [][]string{nil, nil},
+		},
+		{
+			name:   "comment inside a statement",
+			script: "SELECT 1 -- one;\n+ 2;\n",
+			sql:    []string{"SELECT 1 \n+ 2"},
+			args:   [][]string{nil},
+		},
+		{
+			name:   "comment marker in a literal",
+			script: "SELECT '--x;'; -- note\n",
+			sql:    []string{"SELECT '--x;'"},
+			args:   [][]string{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := parseSQLScript("test.sql", []byte(tt.script))
+			if err != nil {
+				t.Fatalf("parseSQLScript: %v", err)
+			}
+			var sql []string
+			var args [][]string
+			for _, c := range script.commands {
+				sql = append(sql, c.sql)
+				args = append(args, c.args)
+			}
+			if !reflect.DeepEqual(sql, tt.sql) {
+				t.Errorf("statements = %q, want %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %q, want %q", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseSQLScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"undefined variable", "SELECT :missing;\n"},
+		{"no statements", "-- nothing\n"},
+		{"unsupported meta-command", "\\sleep 1\nSELECT 1;\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSQLScript("test.sql", []byte(tt.script)); err == nil {
+				t.Errorf("parseSQLScript(%q) succeeded, want an error", tt.script)
+			}
+		})
+	}
+}
+
+func TestParseSQLScriptTransactions(t *testing.T) {
+	script, err := parseSQLScript("test.sql", []byte("BEGIN;\nSELECT 1;\nCOMMIT;\n"))
+	if err != nil {
+		t.Fatalf("parseSQLScript: %v", err)
+	}
+	var tx []string
+	for _, c := range script.commands {
+		tx = append(tx, c.tx)
+	}
+	if want := []string{"begin", "", "commit"}; !reflect.DeepEqual(tx, want) {
+		t.Errorf("transaction control = %q, want %q", tx, want)
+	}
+}
+
+func TestRandomTimeWindow(t *testing.T) {
+	eval, err := parseScriptExpr("random_time(60)")
+	if err != nil {
+		t.Fatalf("parseScriptExpr: %v", err)
+	}
+	dataEnd := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		dataEnd time.Time
+	}{
+		{"seeded data end", dataEnd},
+		{"no data end", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Worker{Rand: rand.New(rand.NewSource(1)), Params: WorkloadParams{DataEnd: tt.dataEnd}}
+			for i := 0; i < 100; i++ {
+				before := time.Now()
+				got := eval(w).(time.Time)
+				lo, hi := before.Add(-time.Minute), time.Now()
+				if !tt.dataEnd.IsZero() {
+					lo, hi = tt.dataEnd.Add(-time.Minute), tt.dataEnd
+				}
+				if got.Before(lo) || got.After(hi) {
+					t.Fatalf("random_time(60) = %v, want between %v and %v", got, lo, hi)
+				}
+			}
+		})
+	}
+}
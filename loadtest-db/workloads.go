@@ -0,0 +1,389 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"time"
+)
+
+// Workload is an operation that scenario files can run by name. Setup and
+// Teardown run once per test; Run is called concurrently by every worker, each
+// with its own Worker state.
+type Workload interface {
+	Description() string
+	// Defaults are the parameters used where a scenario leaves one unset
+	Defaults() WorkloadParams
+	Setup(db *sql.DB, params WorkloadParams) error
+	Run(db *sql.DB, w *Worker) error
+	Teardown(db *sql.DB, params WorkloadParams) error
+}
+
+// WorkloadParams tune a workload. Zero fields take the workload's defaults and
+// workloads ignore the fields that do not apply to them. The ratios are
+// pointers, as 0 is a valid setting for them: nil takes the default.
+type WorkloadParams struct {
+	BatchSize int      `json:"batch_size,omitempty"` // rows per transaction
+	RowWidth  int      `json:"row_width,omitempty"`  // payload bytes per written row
+	KeyRange  int      `json:"key_range,omitempty"`  // reads and updates pick ids in 1..key_range
+	ReadRatio *float64 `json:"read_ratio,omitempty"` // share of reads in mixed workloads, 0-1
+	Devices   int      `json:"devices,omitempty"`    // device ids in device_0..device_N-1
+	Scripts   []string `json:"scripts,omitempty"`    // SQL script files as "path" or "path@weight"
+
+	// Distribution is how ids and devices are picked: uniform (default),
+	// zipfian, hotspot, latest or sequential
+	Distribution string   `json:"distribution,omitempty"`
+	Skew         *float64 `json:"skew,omitempty"`     // zipfian and latest exponent, default 0.99
+	HotKeys      *float64 `json:"hot_keys,omitempty"` // hotspot share of keys that are hot, default 0.2
+	HotOps       *float64 `json:"hot_ops,omitempty"`  // hotspot share of operations on hot keys, default 0.8
+
+	Replay        string   `json:"replay,omitempty"`         // query mix file replayed by the replay workload
+	CaptureWindow Duration `json:"capture_window,omitempty"` // time span the replay file's statistics cover
+
+	// DataEnd is where the time windows of the time series reads end, set to
+	// the end of the seeded data; now if zero
+	DataEnd time.Time `json:"-"`
+}
+
+// Worker is the state of one worker of a running test
+type Worker struct {
+	ID     int
+	Rand   *rand.Rand
+	Params WorkloadParams
+	State  any // owned by the workload, e.g. statements prepared on first use
+
+	keys map[int]*keyChooser // key distribution per key range, see key
+
+	// Trackers of the running test; readSplit is nil unless it targets the proxy
+	readSplit      *readSplitTracker
+	readYourWrites *readYourWritesTracker
+}
+
+// newWorker returns worker id of test, with a generator derived from the run seed
+func newWorker(test string, id int, params WorkloadParams) *Worker {
+	return &Worker{
+		ID:     id,
+		Rand:   derivedRand("worker", test, id),
+		Params: params,
+	}
+}
+
+// now is the end of the time windows of read workloads
+func (w *Worker) now() time.Time {
+	if !w.Params.DataEnd.IsZero() {
+		return w.Params.DataEnd
+	}
+	return time.Now()
+}
+
+// withDefaults fills the unset fields of p from defaults
+func (p WorkloadParams) withDefaults(defaults WorkloadParams) WorkloadParams {
+	if p.BatchSize == 0 {
+		p.BatchSize = defaults.BatchSize
+	}
+	if p.RowWidth == 0 {
+		p.RowWidth = defaults.RowWidth
+	}
+	if p.KeyRange == 0 {
+		p.KeyRange = defaults.KeyRange
+	}
+	if p.ReadRatio == nil {
+		p.ReadRatio = defaults.ReadRatio
+	}
+	if p.Devices == 0 {
+		p.Devices = defaults.Devices
+	}
+	if p.Distribution == "" {
+		p.Distribution = defaults.Distribution
+	}
+	if p.Skew == nil {
+		p.Skew = defaults.Skew
+	}
+	if p.HotKeys == nil {
+		p.HotKeys = defaults.HotKeys
+	}
+	if p.HotOps == nil {
+		p.HotOps = defaults.HotOps
+	}
+	if len(p.Scripts) == 0 {
+		p.Scripts = defaults.Scripts
+	}
+	if p.Replay == "" {
+		p.Replay = defaults.Replay
+	}
+	if p.CaptureWindow == 0 {
+		p.CaptureWindow = defaults.CaptureWindow
+	}
+	return p
+}
+
+func (p WorkloadParams) validate() error {
+	if p.BatchSize < 0 || p.RowWidth < 0 || p.KeyRange < 0 || p.Devices < 0 || p.CaptureWindow < 0 {
+		return fmt.Errorf("workload params must not be negative")
+	}
+	if r := orDefault(p.ReadRatio, 0); r < 0 || r > 1 {
+		return fmt.Errorf("read_ratio must be between 0 and 1")
+	}
+	if !isDistribution(p.Distribution) {
+		return fmt.Errorf("unknown distribution %q (uniform, zipfian, hotspot, latest, sequential)", p.Distribution)
+	}
+	if s := orDefault(p.Skew, defaultSkew); s < 0 || s >= 1 {
+		return fmt.Errorf("skew must be between 0 and 1 (exclusive)")
+	}
+	hotKeys, hotOps := orDefault(p.HotKeys, defaultHotKeys), orDefault(p.HotOps, defaultHotOps)
+	if hotKeys < 0 || hotKeys >= 1 || hotOps < 0 || hotOps > 1 {
+		return fmt.Errorf("hot_keys must be between 0 and 1 (exclusive) and hot_ops between 0 and 1")
+	}
+	return nil
+}
+
+// resolvePaths makes relative script and replay paths relative to dir
+func (p *WorkloadParams) resolvePaths(dir string) {
+	for i, spec := range p.Scripts {
+		if !filepath.IsAbs(spec) {
+			p.Scripts[i] = filepath.Join(dir, spec)
+		}
+	}
+	if p.Replay != "" && !filepath.IsAbs(p.Replay) {
+		p.Replay = filepath.Join(dir, p.Replay)
+	}
+}
+
+// workloads maps the workload names used in scenario files to workloads
+var workloads = map[string]Workload{}
+
+// registerWorkload makes a workload available to scenario files under name
+func registerWorkload(name string, w Workload) {
+	if _, ok := workloads[name]; ok {
+		panic("workload registered twice: " + name)
+	}
+	workloads[name] = w
+}
+
+// funcWorkload is a Workload without setup or teardown
+type funcWorkload struct {
+	description string
+	defaults    WorkloadParams
+	run         func(db *sql.DB, w *Worker) error
+	readOnly    bool // never writes, so it may run in read-only mode
+}
+
+func (f funcWorkload) Description() string                    { return f.description }
+func (f funcWorkload) Defaults() WorkloadParams               { return f.defaults }
+func (f funcWorkload) Setup(*sql.DB, WorkloadParams) error    { return nil }
+func (f funcWorkload) Run(db *sql.DB, w *Worker) error        { return f.run(db, w) }
+func (f funcWorkload) Teardown(*sql.DB, WorkloadParams) error { return nil }
+func (f funcWorkload) ReadOnly(WorkloadParams) bool           { return f.readOnly }
+
+func init() {
+	registerWorkload("simple_read", funcWorkload{"Point SELECT by primary key on loadtest_simple",
+		WorkloadParams{KeyRange: 1000}, testSimpleRead, true})
+	registerWorkload("simple_write", funcWorkload{"Single-row INSERT into loadtest_simple",
+		WorkloadParams{}, testSimpleWrite, false})
+	registerWorkload("simple_update", funcWorkload{"Single-row UPDATE by primary key on loadtest_simple",
+		WorkloadParams{KeyRange: 1000}, testSimpleUpdate, false})
+	registerWorkload("mixed", funcWorkload{"simple_read / simple_write mix (read_ratio, default 0.7)",
+		WorkloadParams{KeyRange: 1000, ReadRatio: ratio(0.7)}, testMixedOperations, false})
+	registerWorkload("batch_insert", funcWorkload{"Multi-row INSERT batch in one transaction (batch_size, default 10)",
+		WorkloadParams{BatchSize: 10}, testBatchInsert, false})
+	registerWorkload("timeseries_insert", funcWorkload{"Single-row INSERT into the loadtest_timeseries hypertable",
+		WorkloadParams{Devices: 100}, testTimeSeriesInsert, false})
+	registerWorkload("time_range_query", funcWorkload{"Last 1-60 minutes of loadtest_timeseries, newest 100 rows",
+		WorkloadParams{}, testTimeRangeQuery, true})
+	registerWorkload("aggregation", funcWorkload{"Per-device aggregates over the last hour of loadtest_timeseries",
+		WorkloadParams{Devices: 10}, testComplexQuery, true})
+}
+
+// payload returns the data column of a written row: prefix plus a unique
+// suffix, padded or cut to row_width if one is set
+func payload(w *Worker, prefix string) string {
+	data := fmt.Sprintf("%s_%d", prefix, w.Rand.Int63())
+	width := w.Params.RowWidth
+	if width <= 0 {
+		return data
+	}
+	if len(data) >= width {
+		return data[:width]
+	}
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, width)
+	copy(b, data)
+	for i := len(data); i < width; i++ {
+		b[i] = letters[w.Rand.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+// backendColumns identify the server that answered a read, so reads through the
+// proxy can be attributed to a backend
+const backendColumns = `COALESCE(host(inet_server_addr()), 'local'), COALESCE(inet_server_port(), 0), pg_is_in_recovery()`
+
+// backendRead holds the backend columns of one read and the tracker they are
+// recorded in. Outside proxy tests it is nil and adds no columns, so reads of
+// primary and replica tests run their queries unchanged.
+type backendRead struct {
+	split   *readSplitTracker
+	addr    string
+	port    int
+	standby bool
+}
+
+func newBackendRead(w *Worker) *backendRead {
+	if w.readSplit == nil {
+		return nil
+	}
+	return &backendRead{split: w.readSplit}
+}
+
+// columns returns the backend columns to append to a select list
+func (b *backendRead) columns() string {
+	if b == nil {
+		return ""
+	}
+	return ", " + backendColumns
+}
+
+// dest appends the scan destinations of the backend columns to dest
+func (b *backendRead) dest(dest ...any) []any {
+	if b == nil {
+		return dest
+	}
+	return append(dest, &b.addr, &b.port, &b.standby)
+}
+
+func (b *backendRead) record() {
+	if b != nil {
+		b.split.record(b.addr, b.port, b.standby)
+	}
+}
+
+func testSimpleRead(db *sql.DB, w *Worker) error {
+	id := w.key(w.Params.KeyRange)
+	var data string
+	var value int
+	backend := newBackendRead(w)
+	err := db.QueryRow(`SELECT data, value`+backend.columns()+` FROM loadtest_simple WHERE id = $1`, id).
+		Scan(backend.dest(&data, &value)...)
+	if err == nil {
+		backend.record()
+	}
+	return err
+}
+
+func testSimpleWrite(db *sql.DB, w *Worker) error {
+	_, err := db.Exec(`INSERT INTO loadtest_simple (data, value) VALUES ($1, $2)`,
+		payload(w, "test_data"), w.Rand.Intn(10000))
+	return err
+}
+
+func testSimpleUpdate(db *sql.DB, w *Worker) error {
+	_, err := db.Exec(`UPDATE loadtest_simple SET data = $1, value = $2 WHERE id = $3`,
+		payload(w, "updated_data"), w.Rand.Intn(10000), w.key(w.Params.KeyRange))
+	return err
+}
+
+func testMixedOperations(db *sql.DB, w *Worker) error {
+	if w.Rand.Float64() < *w.Params.ReadRatio {
+		return testSimpleRead(db, w)
+	}
+	return testSimpleWrite(db, w)
+}
+
+func testBatchInsert(db *sql.DB, w *Worker) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO loadtest_simple (data, value) VALUES ($1, $2)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := 0; i < w.Params.BatchSize; i++ {
+		if _, err := stmt.Exec(payload(w, "batch"), w.Rand.Intn(10000)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func testTimeSeriesInsert(db *sql.DB, w *Worker) error {
+	_, err := db.Exec(`INSERT INTO loadtest_timeseries (time, device_id, temperature, humidity, pressure)
+		VALUES ($1, $2, $3, $4, $5)`,
+		time.Now(),
+		w.device(),
+		20+w.Rand.Float64()*15,
+		30+w.Rand.Float64()*50,
+		1000+w.Rand.Float64()*50)
+	return err
+}
+
+func testTimeRangeQuery(db *sql.DB, w *Worker) error {
+	endTime := w.now()
+	startTime := endTime.Add(-time.Duration(w.Rand.Intn(60)+1) * time.Minute)
+
+	backend := newBackendRead(w)
+	rows, err := db.Query(`SELECT time, device_id, temperature, humidity, pressure`+backend.columns()+`
+		FROM loadtest_timeseries
+		WHERE time >= $1 AND time <= $2
+		ORDER BY time DESC
+		LIMIT 100`, startTime, endTime)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		var t time.Time
+		var deviceID string
+		var temp, humidity, pressure float64
+		if err := rows.Scan(backend.dest(&t, &deviceID, &temp, &humidity, &pressure)...); err != nil {
+			return err
+		}
+		if i == 0 {
+			backend.record()
+		}
+	}
+	return rows.Err()
+}
+
+func testComplexQuery(db *sql.DB, w *Worker) error {
+	deviceID := w.device()
+	endTime := w.now()
+	backend := newBackendRead(w)
+
+	rows, err := db.Query(`
+		SELECT
+			device_id,
+			COUNT(*) as count,
+			AVG(temperature) as avg_temp,
+			MIN(temperature) as min_temp,
+			MAX(temperature) as max_temp,
+			AVG(humidity) as avg_humidity,
+			AVG(pressure) as avg_pressure`+backend.columns()+`
+		FROM loadtest_timeseries
+		WHERE device_id = $1
+		  AND time >= $2 AND time <= $3
+		GROUP BY device_id
+	`, deviceID, endTime.Add(-time.Hour), endTime)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var count int
+		var avgTemp, minTemp, maxTemp, avgHumidity, avgPressure sql.NullFloat64
+		if err := rows.Scan(backend.dest(&id, &count, &avgTemp, &minTemp, &maxTemp, &avgHumidity, &avgPressure)...); err != nil {
+			return err
+		}
+		backend.record()
+	}
+	return rows.Err()
+}